@@ -0,0 +1,403 @@
+package goetf
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+)
+
+// Classes of terms in Erlang term order:
+// number < atom < reference < fun < port < pid < tuple < map < nil < list < bitstring.
+//
+// Ref: https://www.erlang.org/doc/system/expressions.html#term-comparisons
+const (
+	classNumber = iota
+	classAtom
+	classRef
+	classFun
+	classPort
+	classPid
+	classTuple
+	classMap
+	classNil
+	classList
+	classBitString
+	classUnknown
+)
+
+// classOf returns the class of the term held by elem.
+func classOf(elem *binaryElement) int {
+	switch elem.tag {
+	case EttSmallInteger, EttInteger, EttSmallBig, EttLargeBig, EttFloat, EttNewFloat:
+		return classNumber
+	case EttAtom, EttAtomUTF8, EttSmallAtom, EttSmallAtomUTF8:
+		return classAtom
+	case EttRef, EttNewReference, EttNewerReference:
+		return classRef
+	case EttNewFun, EttFun, EttExport:
+		return classFun
+	case EttPort, EttNewPort, EttV4Port:
+		return classPort
+	case EttPid, EttNewPid:
+		return classPid
+	case EttSmallTuple, EttLargeTuple:
+		return classTuple
+	case EttMap:
+		return classMap
+	case EttNil:
+		return classNil
+	case EttList, EttString:
+		return classList
+	case EttBinary, EttBitBinary:
+		return classBitString
+	}
+
+	return classUnknown
+}
+
+// compareElements compares the terms held by a and b in Erlang term order,
+// returning -1, 0 or +1. With exact, an integer is less than a float of the same value,
+// as with the keys of a map; otherwise they are equal, as with the == operator.
+func (d *Decoder) compareElements(a, b *binaryElement, exact bool) int {
+	ca, cb := classOf(a), classOf(b)
+	if ca != cb {
+		return cmp.Compare(ca, cb)
+	}
+
+	switch ca {
+	case classNumber:
+		return d.compareNumbers(a, b, exact)
+
+	case classAtom:
+		return cmp.Compare(d.atomText(a), d.atomText(b))
+
+	case classRef:
+		ra, rb := d.parseRef(a).(Ref), d.parseRef(b).(Ref)
+		if c := cmp.Compare(ra.Node, rb.Node); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(ra.Len, rb.Len); c != 0 {
+			return c
+		}
+		for i := int(ra.Len) - 1; i >= 0; i-- {
+			if c := cmp.Compare(ra.ID[i], rb.ID[i]); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(ra.Creation, rb.Creation)
+
+	case classFun:
+		return d.compareFunctions(a, b, exact)
+
+	case classPort:
+		pa, pb := d.parsePort(a).(Port), d.parsePort(b).(Port)
+		if c := cmp.Compare(pa.Node, pb.Node); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(pa.ID, pb.ID); c != 0 {
+			return c
+		}
+		return cmp.Compare(pa.Creation, pb.Creation)
+
+	case classPid:
+		pa, pb := d.parsePid(a).(Pid), d.parsePid(b).(Pid)
+		if c := cmp.Compare(pa.Node, pb.Node); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(pa.ID, pb.ID); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(pa.Serial, pb.Serial); c != 0 {
+			return c
+		}
+		return cmp.Compare(pa.Creation, pb.Creation)
+
+	case classTuple:
+		if c := cmp.Compare(len(a.items), len(b.items)); c != 0 {
+			return c
+		}
+		return d.compareSequences(a.items, b.items, exact)
+
+	case classMap:
+		return d.compareMaps(a, b, exact)
+
+	case classList:
+		return d.compareLists(a, b, exact)
+
+	case classBitString:
+		ba, lenA := bitStringOf(a)
+		bb, lenB := bitStringOf(b)
+		return compareBits(ba, lenA, bb, lenB)
+	}
+
+	return 0
+}
+
+// compareSequences compares two sequences of the same length element by element.
+func (d *Decoder) compareSequences(a, b []*binaryElement, exact bool) int {
+	for i := range a {
+		if c := d.compareElements(a[i], b[i], exact); c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// compareNumbers compares two integers or floats by their value.
+func (d *Decoder) compareNumbers(a, b *binaryElement, exact bool) int {
+	ia, fa, floatA := d.numberOf(a)
+	ib, fb, floatB := d.numberOf(b)
+
+	switch {
+	case !floatA && !floatB:
+		return ia.Cmp(ib)
+	case floatA && floatB:
+		return cmp.Compare(fa, fb)
+	case floatB:
+		return compareIntFloat(ia, fb, exact)
+	default:
+		return -compareIntFloat(ib, fa, exact)
+	}
+}
+
+// compareIntFloat compares an integer with a float by their value. NaN is less than
+// any integer, as with cmp.Compare, since big.Float can't hold it.
+func compareIntFloat(i *big.Int, f float64, exact bool) int {
+	if math.IsNaN(f) {
+		return 1
+	}
+
+	c := new(big.Float).SetInt(i).Cmp(big.NewFloat(f))
+	if c == 0 && exact {
+		return -1
+	}
+	return c
+}
+
+// numberOf returns the value of an integer element, or of a float element and true.
+func (d *Decoder) numberOf(elem *binaryElement) (*big.Int, float64, bool) {
+	switch elem.tag {
+	case EttSmallInteger:
+		return big.NewInt(int64(d.parseSmallInteger(elem.body))), 0, false
+	case EttInteger:
+		return big.NewInt(int64(d.parseInteger(elem.body))), 0, false
+	case EttSmallBig, EttLargeBig:
+		return d.parseBig(elem.body), 0, false
+	case EttNewFloat:
+		return nil, d.parseNewFloat(elem.body), true
+	default:
+		return nil, d.parseFloat(elem.body), true
+	}
+}
+
+// atomText returns the name of an atom element as UTF-8.
+func (d *Decoder) atomText(elem *binaryElement) string {
+	if elem.tag == EttAtom || elem.tag == EttSmallAtom {
+		return latin1ToUTF8(elem.body)
+	}
+
+	return string(elem.body)
+}
+
+// compareFunctions compares two funs. External funs come before local ones.
+func (d *Decoder) compareFunctions(a, b *binaryElement, exact bool) int {
+	exportA, exportB := a.tag == EttExport, b.tag == EttExport
+	switch {
+	case exportA && exportB:
+		xa, xb := d.parseExport(a).(Export), d.parseExport(b).(Export)
+		return cmp.Or(cmp.Compare(xa.Module, xb.Module), cmp.Compare(xa.Function, xb.Function), cmp.Compare(xa.Arity, xb.Arity))
+	case exportA:
+		return -1
+	case exportB:
+		return 1
+	}
+
+	fa, fb := d.parseFunction(a).(Function), d.parseFunction(b).(Function)
+	if c := cmp.Or(cmp.Compare(fa.Module, fb.Module), cmp.Compare(fa.OldIndex, fb.OldIndex), cmp.Compare(fa.OldUnique, fb.OldUnique)); c != 0 {
+		return c
+	}
+
+	freeA, freeB := freeVarsOf(a), freeVarsOf(b)
+	if c := cmp.Compare(len(freeA), len(freeB)); c != 0 {
+		return c
+	}
+	return d.compareSequences(freeA, freeB, exact)
+}
+
+// freeVarsOf returns the free variable elements of a NEW_FUN_EXT or FUN_EXT element.
+func freeVarsOf(elem *binaryElement) []*binaryElement {
+	if len(elem.items) < 4 {
+		return nil
+	}
+
+	return elem.items[4:]
+}
+
+// compareMaps compares two maps by their size, then by their keys in order,
+// then by the values of those keys.
+func (d *Decoder) compareMaps(a, b *binaryElement, exact bool) int {
+	if c := cmp.Compare(len(a.dict), len(b.dict)); c != 0 {
+		return c
+	}
+
+	pairsA, pairsB := d.sortedPairs(a), d.sortedPairs(b)
+	for i := range pairsA {
+		if c := d.compareElements(pairsA[i][0], pairsB[i][0], true); c != 0 {
+			return c
+		}
+	}
+
+	for i := range pairsA {
+		if c := d.compareElements(pairsA[i][1], pairsB[i][1], exact); c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+// sortedPairs returns the key-value pairs of a map element sorted by key.
+func (d *Decoder) sortedPairs(elem *binaryElement) [][2]*binaryElement {
+	pairs := make([][2]*binaryElement, 0, len(elem.dict)/2)
+	for i := 0; i+1 < len(elem.dict); i += 2 {
+		pairs = append(pairs, [2]*binaryElement{elem.dict[i], elem.dict[i+1]})
+	}
+
+	slices.SortFunc(pairs, func(x, y [2]*binaryElement) int {
+		return d.compareElements(x[0], y[0], true)
+	})
+
+	return pairs
+}
+
+// compareLists compares two non-empty lists head by head. When one of them runs out,
+// its tail is compared with the rest of the other one.
+func (d *Decoder) compareLists(a, b *binaryElement, exact bool) int {
+	headsA, tailA := listView(a)
+	headsB, tailB := listView(b)
+
+	n := min(len(headsA), len(headsB))
+	if c := d.compareSequences(headsA[:n], headsB[:n], exact); c != 0 {
+		return c
+	}
+
+	switch {
+	case len(headsA) == len(headsB):
+		return d.compareElements(tailA, tailB, exact)
+	case len(headsA) < len(headsB):
+		return cmp.Compare(classOf(tailA), classList)
+	default:
+		return cmp.Compare(classList, classOf(tailB))
+	}
+}
+
+// listView returns the heads and the tail of a list element. A STRING_EXT is seen
+// as a list of small integers, and tails that are lists themselves are flattened.
+func listView(elem *binaryElement) ([]*binaryElement, *binaryElement) {
+	heads := []*binaryElement{}
+	for {
+		switch elem.tag {
+		case EttString:
+			for _, c := range elem.body {
+				heads = append(heads, &binaryElement{tag: EttSmallInteger, body: []byte{c}})
+			}
+			return heads, &binaryElement{tag: EttNil}
+
+		case EttList:
+			if len(elem.items) == 0 {
+				return heads, &binaryElement{tag: EttNil}
+			}
+			heads = append(heads, elem.items[:len(elem.items)-1]...)
+			elem = elem.items[len(elem.items)-1]
+
+		default:
+			return heads, elem
+		}
+	}
+}
+
+// bitStringOf returns the bytes of a binary or bitstring element and its length in bits.
+func bitStringOf(elem *binaryElement) ([]byte, int) {
+	if elem.tag == EttBinary || len(elem.body) <= 1 {
+		return elem.body, len(elem.body) * 8
+	}
+
+	bits, data := int(elem.body[0]), elem.body[1:]
+	return data, (len(data)-1)*8 + bits
+}
+
+// compareBits compares two bitstrings bit by bit, and then by their length.
+func compareBits(a []byte, lenA int, b []byte, lenB int) int {
+	n := min(lenA, lenB)
+	whole := n / 8
+	if c := slices.Compare(a[:whole], b[:whole]); c != 0 {
+		return c
+	}
+
+	if rest := n % 8; rest > 0 {
+		mask := byte(0xff << (8 - rest))
+		if c := cmp.Compare(a[whole]&mask, b[whole]&mask); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(lenA, lenB)
+}
+
+// Compare returns -1, 0 or +1 depending on whether a is less than, equal to or greater than b
+// in Erlang term order: number < atom < reference < fun < port < pid < tuple < map < nil < list < bitstring.
+//
+// The terms are compared as Marshal encodes them with the default options, so a Go string is
+// compared as an atom when it can be one. Integers and floats are compared by value, like
+// with the == operator of Erlang, so 1 and 1.0 are equal. Compare panics when a term can't be encoded.
+//
+// Ref: https://www.erlang.org/doc/system/expressions.html#term-comparisons
+func Compare(a, b Term) int {
+	d, elems, err := readElementsOf(DefaultEncoderConfig(), []reflect.Value{valueOf(a), valueOf(b)})
+	if err != nil {
+		panic(fmt.Sprintf("goetf: can't compare terms: %v", err))
+	}
+
+	return d.compareElements(elems[0], elems[1], false)
+}
+
+// readElementsOf encodes values with config and reads them back as elements,
+// along with the decoder that read them.
+func readElementsOf(config *EncoderConfig, values []reflect.Value) (*Decoder, []*binaryElement, error) {
+	buf := bytes.NewBuffer(make([]byte, 0))
+	enc := &Encoder{config: config, w: buf}
+	enc.init()
+
+	for _, v := range values {
+		if !v.IsValid() {
+			enc.writeNil()
+			continue
+		}
+
+		if err := enc.parseType(v); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	data, err := enc.stream.readAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d := NewDecoder(bytes.NewReader(data))
+	d.init()
+
+	elems := make([]*binaryElement, len(values))
+	for i := range elems {
+		if elems[i], err = d.readNext(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return d, elems, nil
+}
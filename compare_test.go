@@ -0,0 +1,82 @@
+package goetf_test
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/nicolito128/goetf"
+)
+
+func TestCompare(t *testing.T) {
+	{
+		pid := goetf.Pid{Node: "a@host", ID: 1}
+		terms := []goetf.Term{
+			[]byte("bin"),
+			goetf.ListImproper{1, 2},
+			map[string]any{"a": 1},
+			goetf.Tuple{1, 2},
+			goetf.Tuple{1},
+			pid,
+			"atom",
+			2.5,
+			big.NewInt(1),
+		}
+
+		slices.SortFunc(terms, goetf.Compare)
+
+		// lists:sort/1 of the same terms
+		want := []goetf.Term{
+			big.NewInt(1),
+			2.5,
+			"atom",
+			pid,
+			goetf.Tuple{1},
+			goetf.Tuple{1, 2},
+			map[string]any{"a": 1},
+			goetf.ListImproper{1, 2},
+			[]byte("bin"),
+		}
+		if !reflect.DeepEqual(want, terms) {
+			t.Errorf("compare error: want = %v got = %v", want, terms)
+		}
+	}
+	{
+		cases := []struct {
+			a, b goetf.Term
+			want int
+		}{
+			{1, 1.0, 0},
+			{10, 9.5, 1},
+			{"ab", "b", -1},
+			{goetf.Tuple{9}, goetf.Tuple{1, 1}, -1},
+			{[]byte{1}, []byte{1, 0}, -1},
+			{goetf.BitString{Bytes: []byte{0xff}, Bits: 1}, []byte{0x7f}, 1},
+			{map[string]int{"b": 1}, map[string]int{"a": 2}, 1},
+			{map[string]int{"a": 1}, map[string]float64{"a": 1}, 0},
+			{-1 << 40, -5, -1},
+			{-1, 0, -1},
+			{-1, 1.5, -1},
+			{-5, -1, -1},
+			{int8(-3), int16(-300), 1},
+			{goetf.Tuple{int8(-3)}, goetf.Tuple{-2}, -1},
+			{new(big.Int).Lsh(big.NewInt(1), 100), 1e30, 1},
+			{goetf.Pid{Node: "a@host", ID: 2}, goetf.Pid{Node: "a@host", ID: 1}, 1},
+			{goetf.ListImproper{1, 2}, goetf.ListImproper{1, 3}, -1},
+			{math.NaN(), 1, -1},
+			{1.0, math.NaN(), 1},
+			{math.Inf(1), new(big.Int).Lsh(big.NewInt(1), 2000), 1},
+			{goetf.List{1, 2}, goetf.List{1, 3}, -1},
+			{goetf.ListImproper{1, 2}, map[string]int{"a": 1}, 1},
+			{goetf.Export{Module: "m", Function: "f", Arity: 1}, goetf.Ref{Node: "a@host"}, 1},
+		}
+
+		for _, c := range cases {
+			if got := goetf.Compare(c.a, c.b); got != c.want {
+				t.Errorf("compare error: %v and %v want = %v got = %v", c.a, c.b, c.want, got)
+			}
+		}
+	}
+}
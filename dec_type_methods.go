@@ -1,10 +1,15 @@
 package goetf
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"math"
 	"math/big"
 	"reflect"
+	"slices"
+	"strconv"
+	"unicode/utf8"
 )
 
 // parseStaticType parses a specific tag type from the input data
@@ -15,10 +20,17 @@ func (d *Decoder) parseStaticType(kind reflect.Kind, tag ExternalTagType, data [
 		return nil
 
 	case EttString:
-		return d.parseString(data)
+		switch kind {
+		default:
+			return d.parseString(data)
+		case reflect.String:
+			return latin1ToUTF8(data)
+		case reflect.Interface:
+			return Charlist(latin1ToUTF8(data))
+		}
 
 	case EttAtom, EttAtomUTF8, EttSmallAtom, EttSmallAtomUTF8:
-		s := d.parseString(data)
+		s := d.parseAtom(newBinaryElement(tag, data))
 		switch {
 		case s == "true":
 			return true
@@ -26,9 +38,11 @@ func (d *Decoder) parseStaticType(kind reflect.Kind, tag ExternalTagType, data [
 			return false
 		case s == "nil":
 			return nil
+		case kind == reflect.Interface:
+			return Atom(s)
 		}
 
-		return d.cache.Deduplicate(s)
+		return s
 
 	case EttSmallInteger:
 		switch kind {
@@ -77,20 +91,15 @@ func (d *Decoder) parseStaticType(kind reflect.Kind, tag ExternalTagType, data [
 		}
 
 	case EttSmallBig:
-		switch kind {
-		default:
-			return d.parseSmallBig(data)
-		case reflect.Int:
-			return int(d.parseSmallBig(data))
+		n := d.parseBig(data)
+		if kind == reflect.Interface && n.IsInt64() {
+			return n.Int64()
 		}
 
+		return d.convertBig(kind, n)
+
 	case EttLargeBig:
-		switch kind {
-		default:
-			return d.parseLargeBig(data)
-		case reflect.Int, reflect.Int64:
-			return d.parseLargeBig(data).Int64()
-		}
+		return d.convertBig(kind, d.parseBig(data))
 
 	case EttBinary:
 		switch kind {
@@ -98,14 +107,25 @@ func (d *Decoder) parseStaticType(kind reflect.Kind, tag ExternalTagType, data [
 			return data
 		case reflect.String:
 			return string(data)
+		case reflect.Interface:
+			return Binary(data)
 		}
 
 	case EttBitBinary:
-		switch kind {
+		bits, bin := data[0], data[1:]
+		whole := bits == 8 || len(bin) == 0
+		switch {
+		case kind == reflect.Struct, kind == reflect.Interface && !whole:
+			return BitString{Bytes: bin, Bits: bits}
+		case !whole:
+			d.err = fmt.Errorf("decode error: bitstring of %d bits can't be decoded into %s", BitString{bin, bits}.BitLen(), kind)
+			return nil
+		case kind == reflect.String:
+			return string(bin)
+		case kind == reflect.Interface:
+			return Binary(bin)
 		default:
-			return data
-		case reflect.String:
-			return string(data)
+			return bin
 		}
 	}
 
@@ -116,6 +136,15 @@ func (d *Decoder) parseString(b []byte) string {
 	return string(b)
 }
 
+// parseAtom returns the name of the atom held by elem as UTF-8, deduplicated by the decoder cache.
+func (d *Decoder) parseAtom(elem *binaryElement) string {
+	// the cache can't hold the empty atom ''
+	if len(elem.body) == 0 {
+		return ""
+	}
+	return d.cache.Deduplicate(d.atomText(elem))
+}
+
 func (d *Decoder) parseSmallInteger(b []byte) uint8 {
 	return uint8(b[0])
 }
@@ -130,39 +159,325 @@ func (d *Decoder) parseNewFloat(b []byte) float64 {
 	return float
 }
 
+// parseFloat parses the NUL-padded "%.20e" text of a FLOAT_EXT.
 func (d *Decoder) parseFloat(b []byte) float64 {
-	// todo: change to use string float IEEE format
-	bits := binary.LittleEndian.Uint64(b)
-	float := math.Float64frombits(bits)
+	float, err := strconv.ParseFloat(string(bytes.TrimRight(b, "\x00")), 64)
+	if err != nil {
+		d.err = errMalformedFloat
+		return 0
+	}
+
 	return float
 }
 
-func (d *Decoder) parseSmallBig(b []byte) int64 {
+// parseBig parses the sign and the little-endian digits of a SMALL_BIG_EXT or LARGE_BIG_EXT.
+func (d *Decoder) parseBig(b []byte) *big.Int {
 	sign := b[0]
-	rest := b[1:]
-
-	bits := binary.LittleEndian.Uint64(rest)
-	smallBig := int64(bits)
+	digits := slices.Clone(b[1:])
+	toLittleEndian(digits)
 
+	n := new(big.Int).SetBytes(digits)
 	if sign == 1 {
-		smallBig *= -1
+		n.Neg(n)
 	}
 
-	return smallBig
+	return n
 }
 
-func (d *Decoder) parseLargeBig(b []byte) *big.Int {
-	sign := b[0]
-	rest := b[1:]
+// convertBig converts n to the Go type of kind, setting an error when n doesn't fit in it.
+//
+// big.Int targets get a big.Int value, everything else that is not a number gets a *big.Int.
+func (d *Decoder) convertBig(kind reflect.Kind, n *big.Int) any {
+	switch kind {
+	default:
+		return n
 
-	bits := binary.LittleEndian.Uint64(rest)
-	largeBig := int64(bits)
+	case reflect.Struct:
+		return *n
 
-	if sign == 1 {
-		largeBig *= -1
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		out := reflect.New(typeOfKind[kind]).Elem()
+		if !n.IsInt64() || out.OverflowInt(n.Int64()) {
+			d.err = fmt.Errorf("decode error: big integer %s overflows %s", n, kind)
+			return nil
+		}
+
+		out.SetInt(n.Int64())
+		return out.Interface()
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		out := reflect.New(typeOfKind[kind]).Elem()
+		if !n.IsUint64() || out.OverflowUint(n.Uint64()) {
+			d.err = fmt.Errorf("decode error: big integer %s overflows %s", n, kind)
+			return nil
+		}
+
+		out.SetUint(n.Uint64())
+		return out.Interface()
+
+	case reflect.Float32, reflect.Float64:
+		f, _ := new(big.Float).SetInt(n).Float64()
+		if kind == reflect.Float32 {
+			return float32(f)
+		}
+
+		return f
+	}
+}
+
+// parsePid builds a Pid from an element holding the node atom as its
+// only item and the ID, serial and creation fields as its body.
+func (d *Decoder) parsePid(elem *binaryElement) any {
+	if len(elem.items) != 1 {
+		d.err = errMalformedPid
+		return nil
+	}
+
+	b := elem.body
+	pid := Pid{
+		Node:   Atom(d.parseAtom(elem.items[0])),
+		ID:     uint64(binary.BigEndian.Uint32(b[:SizePidID])),
+		Serial: binary.BigEndian.Uint32(b[SizePidID : SizePidID+SizePidSerial]),
+	}
+
+	creation := b[SizePidID+SizePidSerial:]
+	if elem.tag == EttNewPid {
+		pid.Creation = binary.BigEndian.Uint32(creation)
+	} else {
+		pid.Creation = uint32(creation[0])
+	}
+
+	return pid
+}
+
+// parsePort builds a Port from an element holding the node atom as its
+// only item and the ID and creation fields as its body.
+func (d *Decoder) parsePort(elem *binaryElement) any {
+	if len(elem.items) != 1 {
+		d.err = errMalformedPort
+		return nil
+	}
+
+	b := elem.body
+	port := Port{
+		Node: Atom(d.parseAtom(elem.items[0])),
+	}
+
+	switch elem.tag {
+	case EttPort:
+		port.ID = uint64(binary.BigEndian.Uint32(b[:SizePortID]))
+		port.Creation = uint32(b[SizePortID])
+	case EttNewPort:
+		port.ID = uint64(binary.BigEndian.Uint32(b[:SizePortID]))
+		port.Creation = binary.BigEndian.Uint32(b[SizePortID:])
+	case EttV4Port:
+		port.ID = binary.BigEndian.Uint64(b[:SizeV4PortID])
+		port.Creation = binary.BigEndian.Uint32(b[SizeV4PortID:])
+	}
+
+	return port
+}
+
+// parseRef builds a Ref from an element holding the node atom as its
+// only item and the creation and ID words as its body.
+func (d *Decoder) parseRef(elem *binaryElement) any {
+	if len(elem.items) != 1 {
+		d.err = errMalformedRef
+		return nil
+	}
+
+	ref := Ref{
+		Node: Atom(d.parseAtom(elem.items[0])),
+	}
+
+	var ids []byte
+	switch elem.tag {
+	case EttRef:
+		ids = elem.body[:SizeRefID]
+		ref.Creation = uint32(elem.body[SizeRefID])
+	case EttNewReference:
+		ref.Creation = uint32(elem.body[0])
+		ids = elem.body[SizeRefCreation:]
+	case EttNewerReference:
+		ref.Creation = binary.BigEndian.Uint32(elem.body)
+		ids = elem.body[SizeNewerRefCreation:]
+	}
+
+	ref.Len = uint16(len(ids) / SizeRefID)
+	for i := range int(ref.Len) {
+		ref.ID[i] = binary.BigEndian.Uint32(ids[i*SizeRefID:])
+	}
+
+	return ref
+}
+
+// parseFunction builds a Function from a NEW_FUN_EXT or FUN_EXT element.
+//
+// For NEW_FUN_EXT the body holds Arity, Uniq, Index and NumFree, and the items are
+// Module, OldIndex, OldUniq, Pid and the free variables.
+// For FUN_EXT the body holds NumFree, and the items are Pid, Module, Index, Uniq
+// and the free variables.
+func (d *Decoder) parseFunction(elem *binaryElement) any {
+	fun := Function{}
+
+	malformed := errMalformedFun
+	if elem.tag == EttNewFun {
+		malformed = errMalformedNewFun
+	}
+
+	if len(elem.items) < 4 {
+		d.err = malformed
+		return nil
+	}
+
+	var module, pid, index, uniq *binaryElement
+	var free []*binaryElement
+	if elem.tag == EttNewFun {
+		b := elem.body
+		fun.Arity = b[0]
+		copy(fun.Unique[:], b[SizeNewFunArity:])
+		fun.Index = binary.BigEndian.Uint32(b[SizeNewFunArity+SizeNewFunUniq:])
+
+		module, index, uniq, pid = elem.items[0], elem.items[1], elem.items[2], elem.items[3]
+		free = elem.items[4:]
+	} else {
+		pid, module, index, uniq = elem.items[0], elem.items[1], elem.items[2], elem.items[3]
+		free = elem.items[4:]
+	}
+
+	fun.Module = Atom(d.parseAtom(module))
+
+	oldIndex, ok := d.parseIntegerElement(index)
+	if !ok {
+		d.err = malformed
+		return nil
+	}
+	fun.OldIndex = uint32(oldIndex)
+
+	oldUniq, ok := d.parseIntegerElement(uniq)
+	if !ok {
+		d.err = malformed
+		return nil
+	}
+	fun.OldUnique = uint32(oldUniq)
+
+	if pid.tag != EttPid && pid.tag != EttNewPid {
+		d.err = malformed
+		return nil
+	}
+
+	if fun.Pid, ok = d.parsePid(pid).(Pid); !ok {
+		return nil
+	}
+
+	fun.FreeVars = make([]Term, len(free))
+	for i, item := range free {
+		fun.FreeVars[i] = d.decodeValue(item, reflect.ValueOf(&fun.FreeVars[i]).Elem())
+	}
+
+	return fun
+}
+
+// parseExport builds an Export from an element holding the module atom,
+// the function atom and the arity as its items.
+func (d *Decoder) parseExport(elem *binaryElement) any {
+	if len(elem.items) != 3 || elem.items[2].tag != EttSmallInteger {
+		d.err = errMalformedExport
+		return nil
+	}
+
+	return Export{
+		Module:   Atom(d.parseAtom(elem.items[0])),
+		Function: Atom(d.parseAtom(elem.items[1])),
+		Arity:    int(d.parseSmallInteger(elem.items[2].body)),
+	}
+}
+
+// parseIntegerElement returns the value of a SMALL_INTEGER_EXT or INTEGER_EXT element.
+func (d *Decoder) parseIntegerElement(elem *binaryElement) (int64, bool) {
+	switch elem.tag {
+	case EttSmallInteger:
+		return int64(d.parseSmallInteger(elem.body)), true
+	case EttInteger:
+		return int64(d.parseInteger(elem.body)), true
+	}
+
+	return 0, false
+}
+
+// parseBinaryElement returns the bytes of a BINARY_EXT element, or of a BIT_BINARY_EXT
+// element made of whole bytes.
+func (d *Decoder) parseBinaryElement(elem *binaryElement) ([]byte, bool) {
+	switch elem.tag {
+	case EttBinary:
+		return elem.body, true
+	case EttBitBinary:
+		if len(elem.body) > 0 && (elem.body[0] == 8 || len(elem.body) == 1) {
+			return elem.body[1:], true
+		}
+	}
+
+	return nil, false
+}
+
+// parseTextElement returns the UTF-8 text of a binary or a charlist element.
+func (d *Decoder) parseTextElement(elem *binaryElement) ([]byte, bool) {
+	if b, ok := d.parseBinaryElement(elem); ok {
+		return b, true
 	}
 
-	return big.NewInt(largeBig)
+	return d.parseCharlist(elem)
+}
+
+// parseCharlist returns the UTF-8 text of a charlist element: the empty list,
+// a STRING_EXT or a proper list of code points.
+func (d *Decoder) parseCharlist(elem *binaryElement) ([]byte, bool) {
+	var runes []rune
+	switch elem.tag {
+	case EttNil:
+		return []byte{}, true
+
+	case EttString:
+		return []byte(latin1ToUTF8(elem.body)), true
+
+	case EttList:
+		if isImproperList(elem) {
+			return nil, false
+		}
+
+		runes = make([]rune, 0, len(elem.items)-1)
+		for _, item := range elem.items[:len(elem.items)-1] {
+			r, ok := d.parseIntegerElement(item)
+			if !ok || r < 0 || r > utf8.MaxRune {
+				return nil, false
+			}
+			runes = append(runes, rune(r))
+		}
+
+	default:
+		return nil, false
+	}
+
+	return []byte(string(runes)), true
+}
+
+// parseWireElement returns the text of elem when it's the wire type required by a field tag.
+func (d *Decoder) parseWireElement(wire string, elem *binaryElement) ([]byte, bool) {
+	switch wire {
+	case wireAtom:
+		switch elem.tag {
+		case EttAtomUTF8, EttSmallAtomUTF8:
+			return elem.body, true
+		case EttAtom, EttSmallAtom:
+			return []byte(latin1ToUTF8(elem.body)), true
+		}
+	case wireBinary:
+		return d.parseBinaryElement(elem)
+	case wireCharlist:
+		return d.parseCharlist(elem)
+	}
+
+	return nil, false
 }
 
 // readStaticType reads a specific tag type from the underlying buffer,
@@ -195,11 +510,80 @@ func (d *Decoder) readStaticType(tag ExternalTagType) (n int, b []byte, err erro
 		n, b, err = d.readBinary()
 	case EttBitBinary:
 		n, b, err = d.readBitBinary()
+	case EttPid:
+		n, b, err = d.readIdentifier(SizePidID+SizePidSerial+SizePidCreation, errMalformedPid)
+	case EttNewPid:
+		n, b, err = d.readIdentifier(SizePidID+SizePidSerial+SizeNewPidCreation, errMalformedNewPid)
+	case EttPort:
+		n, b, err = d.readIdentifier(SizePortID+SizePortCreation, errMalformedPort)
+	case EttNewPort:
+		n, b, err = d.readIdentifier(SizePortID+SizeNewPortCreation, errMalformedNewPort)
+	case EttV4Port:
+		n, b, err = d.readIdentifier(SizeV4PortID+SizeNewPortCreation, errMalformedV4Port)
+	case EttRef:
+		n, b, err = d.readIdentifier(SizeRefID+SizeRefCreation, errMalformedRef)
+	case EttNewFun:
+		n, b, err = d.readIdentifier(SizeNewFunArity+SizeNewFunUniq+SizeNewFunIndex+SizeNewFunNumFree, errMalformedNewFun)
+	case EttFun:
+		n, b, err = d.readIdentifier(SizeFunNumFree, errMalformedFun)
+	}
+
+	if err == nil {
+		switch tag {
+		case EttAtom, EttAtomUTF8, EttSmallAtom, EttSmallAtomUTF8:
+			err = d.checkAtom(tag, b)
+		}
 	}
 
 	return
 }
 
+// readAtom reads the next term from the underlying buffer, which must be an atom.
+func (d *Decoder) readAtom() (*binaryElement, error) {
+	tag, err := d.scan.readByte()
+	if err != nil {
+		return nil, errMalformed
+	}
+
+	switch tag {
+	case EttAtom, EttAtomUTF8, EttSmallAtom, EttSmallAtomUTF8:
+	default:
+		return nil, errMalformed
+	}
+
+	_, data, err := d.readStaticType(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBinaryElement(tag, data), nil
+}
+
+// readIdentifier reads size bytes of fixed fields, such as the ones that follow
+// the node atom of a pid, port or reference, or the header of a fun.
+func (d *Decoder) readIdentifier(size SizeType, malformed error) (int, []byte, error) {
+	n, data, err := d.scan.readN(size)
+	if err != nil {
+		return n, data, malformed
+	}
+
+	if n < size {
+		return n, data, malformed
+	}
+
+	return n, data, nil
+}
+
+// readNewReference reads the creation and the length ID words of a NEW_REFERENCE_EXT
+// or NEWER_REFERENCE_EXT. The length and node atom must be read before calling it.
+func (d *Decoder) readNewReference(tag ExternalTagType, length int) (int, []byte, error) {
+	if tag == EttNewReference {
+		return d.readIdentifier(SizeRefCreation+length*SizeRefID, errMalformedNewRef)
+	}
+
+	return d.readIdentifier(SizeNewerRefCreation+length*SizeRefID, errMalformedNewerRef)
+}
+
 func (d *Decoder) readBitBinary() (int, []byte, error) {
 	n, bLen, err := d.scan.readN(SizeBitBinaryLen)
 	if err != nil {
@@ -211,18 +595,30 @@ func (d *Decoder) readBitBinary() (int, []byte, error) {
 	}
 
 	length := int(binary.BigEndian.Uint32(bLen))
+	if err := d.checkBinarySize(length); err != nil {
+		return n, bLen, err
+	}
 
-	_, err = d.scan.readByte()
+	bits, err := d.scan.readByte()
 	if err != nil {
 		return n + 1, bLen, errMalformedBitBinary
 	}
 
+	if bits > 8 || (bits == 0 && length > 0) {
+		return n + 1, bLen, errMalformedBitBinary
+	}
+
 	n, data, err := d.scan.readN(length)
-	if err != nil {
+	if err != nil || n < length {
 		return n, data, errMalformedBitBinary
 	}
 
-	return n, data, nil
+	// the bits used in the last byte are stored internally as the first byte
+	bitBinary := make([]byte, length+1)
+	bitBinary[0] = bits
+	copy(bitBinary[1:], data)
+
+	return n, bitBinary, nil
 }
 
 func (d *Decoder) readAtomUTF8() (int, []byte, error) {
@@ -232,9 +628,9 @@ func (d *Decoder) readAtomUTF8() (int, []byte, error) {
 	}
 	length := int(binary.BigEndian.Uint16(bLen))
 
-	// {..., 118, 0, 0, ...}
+	// the empty atom '', which has nothing more to read
 	if length == 0 {
-		return n, bLen, errMalformedAtomUTF8
+		return n, []byte{}, nil
 	}
 
 	n, data, err := d.scan.readN(length)
@@ -253,8 +649,9 @@ func (d *Decoder) readSmallAtomUTF8() (int, []byte, error) {
 
 	length := int(bLen)
 
+	// the empty atom '', which has nothing more to read
 	if length == 0 {
-		return 1, nil, errMalformedSmallAtomUTF8
+		return 1, []byte{}, nil
 	}
 
 	n, data, err := d.scan.readN(length)
@@ -275,21 +672,21 @@ func (d *Decoder) readLargeBig() (int, []byte, error) {
 		return n, bN, errMalformedLargeBig
 	}
 	N := int(binary.BigEndian.Uint32(bN))
+	if err := d.checkBinarySize(N); err != nil {
+		return n, bN, err
+	}
 
 	sign, err := d.scan.readByte()
 	if err != nil {
 		return n, nil, errMalformedLargeBig
 	}
 
-	n, data, err := d.scan.readN(N) // N+1 to store internaly the sign
-	if err != nil {
-		return n, data, errMalformedSmallBig
-	}
-
-	if N < 8 {
-		N += 8 - N
+	n, data, err := d.scan.readN(N)
+	if err != nil || n < N {
+		return n, data, errMalformedLargeBig
 	}
 
+	// the sign is stored internally as the first byte
 	largeBig := make([]byte, N+1)
 	largeBig[0] = sign
 	copy(largeBig[1:], data)
@@ -311,16 +708,12 @@ func (d *Decoder) readSmallBig() (int, []byte, error) {
 		return 1, nil, errMalformedSmallBig
 	}
 
-	// fill with 0 to allow parsing
-	n, data, err := d.scan.readN(N) // N+1 to store internaly the sign
-	if err != nil {
+	n, data, err := d.scan.readN(N)
+	if err != nil || n < N {
 		return n, data, errMalformedSmallBig
 	}
 
-	if N < 8 {
-		N += 8 - N
-	}
-
+	// the sign is stored internally as the first byte
 	smallBig := make([]byte, N+1)
 	smallBig[0] = sign
 	copy(smallBig[1:], data)
@@ -334,6 +727,9 @@ func (d *Decoder) readBinary() (int, []byte, error) {
 		return n, bLen, errMalformedBinary
 	}
 	length := int(binary.BigEndian.Uint32(bLen))
+	if err := d.checkBinarySize(length); err != nil {
+		return n, bLen, err
+	}
 
 	n, binary, err := d.scan.readN(length)
 	if err != nil {
@@ -358,6 +754,10 @@ func (d *Decoder) readString() (int, []byte, error) {
 		return n, bLen, errMalformedString
 	}
 
+	if err := d.checkLen(length); err != nil {
+		return n, bLen, err
+	}
+
 	n, bStr, err := d.scan.readN(length)
 	if err != nil {
 		return n, bStr, errMalformedString
@@ -403,5 +803,9 @@ func (d *Decoder) readFloat() (int, []byte, error) {
 		return n, num, errMalformedFloat
 	}
 
+	if n < SizeFloat {
+		return n, num, errMalformedFloat
+	}
+
 	return n, num, nil
 }
@@ -2,6 +2,9 @@ package goetf
 
 import (
 	"bytes"
+	"cmp"
+	"compress/zlib"
+	"encoding"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -13,10 +16,10 @@ import (
 )
 
 // Unmarshaler is the interface implemented by types that can unmarshal a ETF description of themselves.
-// The input can be assumed to be a valid encoding of a ETF value.
-// UnmarshalETF must copy the ETF data if it wishes to retain the data after returning.
+// The input is the encoding of a single term, starting with the version number, so it can be
+// passed to Unmarshal. UnmarshalETF must copy the ETF data if it wishes to retain the data after returning.
 type Unmarshaler interface {
-	UnmarshalETF(data []byte, dst any) (err error)
+	UnmarshalETF(data []byte) error
 }
 
 // Unmarshal parses the ETF-encoded data and stores the result in the value pointed to by v.
@@ -39,6 +42,13 @@ type Decoder struct {
 	dirty bool
 	// error to check
 	err error
+
+	// atoms allowed by the config, nil allows any atom
+	allowed map[Atom]bool
+	// nesting depth of the term being read
+	depth int
+	// distinct atoms read in this Decode call, only tracked with MaxNewAtoms
+	newAtoms map[string]struct{}
 }
 
 // NewDecoder returns a new *Decoder that reads from r.
@@ -52,11 +62,20 @@ func NewDecoder(r io.Reader, opts ...DecoderOpt) *Decoder {
 	d := &Decoder{r: r, config: c}
 	if (len(opts) > 0 && c.CacheSize <= 0) || c.CacheSize == DefaultCacheSize {
 		d.config.CacheSize = DefaultCacheSize
-		d.cache = defaultInternalCache
+		// untrusted input, limited by MaxNewAtoms, gets its own cache and can't grow the shared one
+		if c.MaxNewAtoms <= 0 {
+			d.cache = defaultInternalCache
+		}
 	}
 	return d
 }
 
+// DisallowUnknownFields causes the Decoder to return an error when a map or proplist
+// decoded into a struct has a key that doesn't match any of its fields.
+func (d *Decoder) DisallowUnknownFields() {
+	d.config.DisallowUnknownFields = true
+}
+
 // Decode reads the next ETF-encoded data from its buffer and stores it in the value pointed to by v.
 func (d *Decoder) Decode(v any) error {
 	d.init()
@@ -71,14 +90,78 @@ func (d *Decoder) init() {
 	if d.scan == nil {
 		d.scan = newScanner(d.r)
 	}
+
+	if d.allowed == nil && d.config.AllowedAtoms != nil {
+		d.allowed = map[Atom]bool{"true": true, "false": true, "nil": true}
+		for _, atom := range d.config.AllowedAtoms {
+			d.allowed[atom] = true
+		}
+	}
+}
+
+// fail keeps err as the decoding error, so it isn't hidden by a malformed error of an enclosing term.
+func (d *Decoder) fail(err error) error {
+	d.err = err
+	return err
+}
+
+// checkLen checks the length of a collection against the MaxCollectionLen limit.
+func (d *Decoder) checkLen(n int) error {
+	if max := d.config.MaxCollectionLen; max > 0 && n > max {
+		return d.fail(&LimitError{Limit: "MaxCollectionLen", Max: max})
+	}
+
+	return nil
+}
+
+// checkBinarySize checks the size of a binary against the MaxBinarySize limit.
+func (d *Decoder) checkBinarySize(n int) error {
+	if max := d.config.MaxBinarySize; max > 0 && n > max {
+		return d.fail(&LimitError{Limit: "MaxBinarySize", Max: max})
+	}
+
+	return nil
+}
+
+// checkAtom checks an atom against the AllowedAtoms and MaxNewAtoms limits.
+//
+// Atoms are only added to the cache once the term is decoded, so the atoms are counted
+// apart from the cache, and a term over the limit leaves the cache untouched.
+func (d *Decoder) checkAtom(tag ExternalTagType, b []byte) error {
+	max := d.config.MaxNewAtoms
+	if d.allowed == nil && max <= 0 {
+		return nil
+	}
+
+	name := d.atomText(newBinaryElement(tag, b))
+	if d.allowed != nil && !d.allowed[Atom(name)] {
+		return d.fail(&AtomError{Atom: Atom(name)})
+	}
+
+	if max > 0 {
+		if d.newAtoms == nil {
+			d.newAtoms = make(map[string]struct{})
+		}
+		d.newAtoms[name] = struct{}{}
+
+		if len(d.newAtoms) > max {
+			return d.fail(&LimitError{Limit: "MaxNewAtoms", Max: max})
+		}
+	}
+
+	return nil
 }
 
 func (d *Decoder) decode(v any) error {
+	d.scan.limit(d.config.MaxInputSize)
+	d.depth = 0
+	clear(d.newAtoms)
+
 	// if the buffer is not dirty check for the version number
 	if !d.dirty {
 		ver, err := d.scan.readByte()
 		if err != nil {
-			return err
+			return cmp.Or(d.scan.err, err)
 		}
 
 		if ver != Version {
@@ -90,20 +173,25 @@ func (d *Decoder) decode(v any) error {
 
 	vOf := valueOf(v)
 	if vOf.Type().Kind() == reflect.Pointer {
-		vOf = derefValueOf(vOf.Elem())
+		vOf = indirectValueOf(vOf.Elem())
+	}
+
+	if !vOf.IsValid() {
+		return fmt.Errorf("invalid decode value: nil pointer")
 	}
 
+	// a nil slice or map can only be filled when it's reachable through a pointer
 	switch vOf.Type().Kind() {
 	case reflect.Map, reflect.Slice:
-		if vOf.IsNil() {
+		if vOf.IsNil() && !vOf.CanSet() {
 			return fmt.Errorf("invalid decode value: nil reference to slice or map")
 		}
 	}
 
 	for !d.scan.eof() {
-		elem, err := d.readNext()
+		elem, err := d.readRoot()
 		if err != nil {
-			return err
+			return cmp.Or(d.err, d.scan.err, err)
 		}
 
 		parsed := d.decodeValue(elem, v)
@@ -112,8 +200,15 @@ func (d *Decoder) decode(v any) error {
 		}
 
 		if parsed != nil {
+			if vOf.Type().Kind() == reflect.Interface && valueOf(parsed).Type().AssignableTo(vOf.Type()) {
+				vOf.Set(valueOf(parsed))
+				continue
+			}
+
 			parsedOf := derefValueOf(parsed)
 			if parsedOf.IsValid() {
+				parsedOf = convertValueOf(parsedOf, vOf.Type())
+
 				if vOf.Type().Kind() == reflect.Map || parsedOf.Type().Kind() == reflect.Map {
 					return nil
 				}
@@ -125,6 +220,67 @@ func (d *Decoder) decode(v any) error {
 		}
 	}
 
+	switch vOf.Type().Kind() {
+	case reflect.Map, reflect.Slice:
+		if vOf.IsNil() {
+			return fmt.Errorf("invalid decode value: nil reference to slice or map")
+		}
+	}
+
+	return nil
+}
+
+// readRoot reads a term at the top of the stream, inflating it first when it's compressed.
+func (d *Decoder) readRoot() (*binaryElement, error) {
+	typeTag, err := d.scan.readByte()
+	if err != nil {
+		return nil, errMalformed
+	}
+
+	if typeTag == EttCompressed {
+		if err := d.inflate(); err != nil {
+			return nil, err
+		}
+
+		typeTag, err = d.scan.readByte()
+		if err != nil {
+			return nil, errMalformedCompressed
+		}
+	}
+
+	return d.readElement(typeTag)
+}
+
+// inflate reads a zlib compressed term, checks its declared uncompressed size, and
+// puts the inflated bytes in front of the rest of the stream.
+func (d *Decoder) inflate() error {
+	_, bSize, err := d.scan.readN(SizeCompressedSize)
+	if err != nil {
+		return errMalformedCompressed
+	}
+	size := int64(binary.BigEndian.Uint32(bSize))
+	if err := d.scan.allow(size); err != nil {
+		return err
+	}
+
+	zr, err := zlib.NewReader(d.scan.r)
+	if err != nil {
+		return errMalformedCompressed
+	}
+	defer zr.Close()
+
+	// the declared size can't be trusted, so the buffer only grows with the inflated data
+	var data bytes.Buffer
+	if n, err := data.ReadFrom(io.LimitReader(zr, size)); err != nil || n != size {
+		return errMalformedCompressed
+	}
+
+	// the stream must end right at the declared size, which also verifies its checksum
+	if n, err := io.CopyN(io.Discard, zr, 1); n != 0 || err != io.EOF {
+		return errMalformedCompressed
+	}
+
+	d.scan.r = io.MultiReader(bytes.NewReader(data.Bytes()), d.scan.r)
 	return nil
 }
 
@@ -134,7 +290,31 @@ func (d *Decoder) readNext() (*binaryElement, error) {
 		return nil, errMalformed
 	}
 
+	return d.readElement(typeTag)
+}
+
+// readElement reads the term that starts with typeTag, which has just been read.
+func (d *Decoder) readElement(typeTag ExternalTagType) (*binaryElement, error) {
+	start := d.scan.scanp - 1
 	dst := newBinaryElement(typeTag, nil)
+
+	switch typeTag {
+	case EttSmallTuple, EttLargeTuple, EttList, EttMap, EttNewFun, EttFun:
+		d.depth++
+		defer func() { d.depth-- }()
+
+		if max := d.config.MaxDepth; max > 0 && d.depth > max {
+			return nil, d.fail(&LimitError{Limit: "MaxDepth", Max: max})
+		}
+	}
+
+	switch typeTag {
+	case EttNewFun, EttFun, EttExport:
+		if d.config.RejectFuns {
+			return nil, d.fail(ErrFunRejected)
+		}
+	}
+
 	switch typeTag {
 	default:
 		_, data, err := d.readStaticType(typeTag)
@@ -150,8 +330,8 @@ func (d *Decoder) readNext() (*binaryElement, error) {
 		}
 
 		arity := int(bArity)
-		if arity == 0 {
-			return nil, errMalformedSmallTuple
+		if err := d.checkLen(arity); err != nil {
+			return nil, err
 		}
 
 		for range arity {
@@ -170,8 +350,8 @@ func (d *Decoder) readNext() (*binaryElement, error) {
 		}
 
 		arity := int(binary.BigEndian.Uint32(bArity))
-		if arity == 0 {
-			return nil, errMalformedLargeTuple
+		if err := d.checkLen(arity); err != nil {
+			return nil, err
 		}
 
 		for range arity {
@@ -194,6 +374,10 @@ func (d *Decoder) readNext() (*binaryElement, error) {
 			return nil, errMalformedList
 		}
 
+		if err := d.checkLen(length); err != nil {
+			return nil, err
+		}
+
 		for range length + 1 {
 			elem, err := d.readNext()
 			if err != nil {
@@ -203,6 +387,130 @@ func (d *Decoder) readNext() (*binaryElement, error) {
 			dst.append(typeTag, elem)
 		}
 
+	case EttPid, EttNewPid, EttPort, EttNewPort, EttV4Port, EttRef:
+		node, err := d.readAtom()
+		if err != nil {
+			return nil, err
+		}
+		dst.append(typeTag, node)
+
+		_, data, err := d.readStaticType(typeTag)
+		if err != nil {
+			return nil, err
+		}
+		dst.put(typeTag, data)
+
+	case EttNewFun:
+		start := d.scan.scanned
+		_, bSize, err := d.scan.readN(SizeNewFunSize)
+		if err != nil {
+			return nil, errMalformedNewFun
+		}
+		size := int64(binary.BigEndian.Uint32(bSize))
+
+		_, data, err := d.readStaticType(typeTag)
+		if err != nil {
+			return nil, err
+		}
+		dst.put(typeTag, data)
+
+		module, err := d.readAtom()
+		if err != nil {
+			return nil, err
+		}
+		dst.append(typeTag, module)
+
+		// OldIndex, OldUniq, Pid and the free variables
+		numFree := int(binary.BigEndian.Uint32(data[SizeNewFunArity+SizeNewFunUniq+SizeNewFunIndex:]))
+		if err := d.checkLen(numFree); err != nil {
+			return nil, err
+		}
+
+		for range 3 + numFree {
+			elem, err := d.readNext()
+			if err != nil {
+				return nil, err
+			}
+
+			dst.append(typeTag, elem)
+		}
+
+		if d.scan.scanned-start != size {
+			return nil, errMalformedNewFun
+		}
+
+	case EttFun:
+		_, data, err := d.readStaticType(typeTag)
+		if err != nil {
+			return nil, err
+		}
+		dst.put(typeTag, data)
+
+		pid, err := d.readNext()
+		if err != nil {
+			return nil, err
+		}
+		dst.append(typeTag, pid)
+
+		module, err := d.readAtom()
+		if err != nil {
+			return nil, err
+		}
+		dst.append(typeTag, module)
+
+		// Index, Uniq and the free variables
+		numFree := int(binary.BigEndian.Uint32(data))
+		if err := d.checkLen(numFree); err != nil {
+			return nil, err
+		}
+
+		for range 2 + numFree {
+			elem, err := d.readNext()
+			if err != nil {
+				return nil, err
+			}
+
+			dst.append(typeTag, elem)
+		}
+
+	case EttExport:
+		for range 2 {
+			atom, err := d.readAtom()
+			if err != nil {
+				return nil, err
+			}
+			dst.append(typeTag, atom)
+		}
+
+		arity, err := d.readNext()
+		if err != nil {
+			return nil, err
+		}
+		dst.append(typeTag, arity)
+
+	case EttNewReference, EttNewerReference:
+		_, bLen, err := d.scan.readN(SizeRefLen)
+		if err != nil {
+			return nil, errMalformedNewRef
+		}
+
+		length := int(binary.BigEndian.Uint16(bLen))
+		if length == 0 || length > len(Ref{}.ID) {
+			return nil, errMalformedNewRef
+		}
+
+		node, err := d.readAtom()
+		if err != nil {
+			return nil, err
+		}
+		dst.append(typeTag, node)
+
+		_, data, err := d.readNewReference(typeTag, length)
+		if err != nil {
+			return nil, err
+		}
+		dst.put(typeTag, data)
+
 	case EttMap:
 		_, bArity, err := d.scan.readN(SizeMapArity)
 		if err != nil {
@@ -210,8 +518,8 @@ func (d *Decoder) readNext() (*binaryElement, error) {
 		}
 
 		arity := int(binary.BigEndian.Uint32(bArity))
-		if arity == 0 {
-			return nil, errMalformedMap
+		if err := d.checkLen(arity); err != nil {
+			return nil, err
 		}
 
 		for range arity {
@@ -230,6 +538,7 @@ func (d *Decoder) readNext() (*binaryElement, error) {
 		}
 	}
 
+	dst.raw = d.scan.since(start)
 	return dst, nil
 }
 
@@ -250,6 +559,29 @@ func (d *Decoder) decodeValue(elem *binaryElement, v any) any {
 		}
 	}
 
+	if implementsUnmarshaler(vOf.Type(), typeOfUnmarshaler) {
+		return d.decodeUnmarshaler(elem, vOf)
+	}
+
+	// big.Int implements encoding.TextUnmarshaler, but it has its own terms
+	if derefTypeOf(vOf.Type()) != typeOfBigInt {
+		if implementsUnmarshaler(vOf.Type(), typeOfTextUnmarshaler) {
+			if text, ok := d.parseTextElement(elem); ok {
+				return d.decodeTextUnmarshaler(text, vOf)
+			}
+		}
+
+		if implementsUnmarshaler(vOf.Type(), typeOfBinaryUnmarshaler) {
+			if bin, ok := d.parseBinaryElement(elem); ok {
+				return d.decodeBinaryUnmarshaler(bin, vOf)
+			}
+		}
+	}
+
+	if derefTypeOf(vOf.Type()) == typeOfKey {
+		return d.keyOf(elem)
+	}
+
 	kind = derefTypeOf(vOf.Type()).Kind()
 	switch elem.tag {
 	default:
@@ -260,17 +592,73 @@ func (d *Decoder) decodeValue(elem *binaryElement, v any) any {
 			}
 		}
 
+	case EttNil:
+		// the empty list is an empty slice, not a nil one
+		if kind == reflect.Slice {
+			return reflect.MakeSlice(derefTypeOf(vOf.Type()), 0, 0).Interface()
+		}
+
+		if derefTypeOf(vOf.Type()) == typeOfTerm {
+			return List{}
+		}
+
+		// an empty proplist still sets the defaults of a struct
+		if kind == reflect.Struct && structLayoutOf(derefTypeOf(vOf.Type())).kind == layoutProplist {
+			return d.decodeProplistStruct(elem, vOf)
+		}
+
+	case EttString:
+		// a list of small integers like [1, 2, 3] is sent as a string
+		if (kind == reflect.Slice || kind == reflect.Array) && derefTypeOf(vOf.Type()) != typeOfBytes {
+			return d.decodeCharList(elem, vOf)
+		}
+
+		return d.parseStaticType(kind, elem.tag, elem.body)
+
+	case EttPid, EttNewPid:
+		return d.parsePid(elem)
+
+	case EttPort, EttNewPort, EttV4Port:
+		return d.parsePort(elem)
+
+	case EttRef, EttNewReference, EttNewerReference:
+		return d.parseRef(elem)
+
+	case EttNewFun, EttFun:
+		return d.parseFunction(elem)
+
+	case EttExport:
+		return d.parseExport(elem)
+
 	case EttSmallTuple, EttLargeTuple:
-		if len(elem.items) > 0 {
-			if kind == reflect.Interface {
-				return d.decodeAnyTuple(elem, vOf)
-			} else {
-				return d.decodeTuple(elem, vOf)
+		if kind == reflect.Struct {
+			if layout := structLayoutOf(derefTypeOf(vOf.Type())); layout.kind != "" {
+				return d.decodeRecord(elem, vOf, layout)
 			}
 		}
 
+		if kind == reflect.Interface {
+			return d.decodeAnyTuple(elem, vOf)
+		}
+
+		if len(elem.items) > 0 {
+			return d.decodeTuple(elem, vOf)
+		}
+
 	case EttList:
+		if kind == reflect.Struct && structLayoutOf(derefTypeOf(vOf.Type())).kind == layoutProplist {
+			return d.decodeProplistStruct(elem, vOf)
+		}
+
+		if derefTypeOf(vOf.Type()) == typeOfProplist {
+			return d.decodeProplist(elem)
+		}
+
 		if len(elem.items) > 0 {
+			if derefTypeOf(vOf.Type()) == typeOfListImproper {
+				return d.decodeImproperList(elem)
+			}
+
 			if kind == reflect.Interface {
 				return d.decodeAnyList(elem, vOf)
 			} else {
@@ -279,7 +667,12 @@ func (d *Decoder) decodeValue(elem *binaryElement, v any) any {
 		}
 
 	case EttMap:
-		if len(elem.dict) > 0 {
+		if kind == reflect.Interface {
+			return d.decodeAnyMap(elem)
+		}
+
+		// an empty map still sets the defaults of a struct
+		if len(elem.dict) > 0 || kind == reflect.Struct {
 			switch kind {
 			case reflect.Struct:
 				if vOf.Type() == typeOfBigInt {
@@ -296,12 +689,18 @@ func (d *Decoder) decodeValue(elem *binaryElement, v any) any {
 					return d.decodeStruct(elem, vOf)
 				}
 
-			case reflect.Interface:
-				return d.decodeAnyMap(elem)
-
 			case reflect.Map:
-				parsedOf := valueOf(d.decodeMap(elem, vOf))
-				if vOf.Type().Kind() == reflect.Map && parsedOf.Type().Kind() == reflect.Map {
+				target := indirectValueOf(vOf)
+				if target.IsNil() {
+					if !target.CanSet() {
+						d.err = fmt.Errorf("invalid decode value: nil reference to map")
+						return nil
+					}
+					target.Set(reflect.MakeMap(target.Type()))
+				}
+
+				parsedOf := valueOf(d.decodeMap(elem, target))
+				if parsedOf.IsValid() && parsedOf.Type().Kind() == reflect.Map {
 					keys := parsedOf.MapKeys()
 					for _, key := range keys {
 						mValOf := parsedOf.MapIndex(key)
@@ -309,12 +708,12 @@ func (d *Decoder) decodeValue(elem *binaryElement, v any) any {
 							return nil
 						}
 
-						setValueNotPtr(vOf.Type().Elem(), mValOf, func(out reflect.Value) {
-							vOf.SetMapIndex(key.Convert(vOf.Type().Key()), out.Convert(vOf.Type().Elem()))
+						setValueNotPtr(target.Type().Elem(), mValOf, func(out reflect.Value) {
+							target.SetMapIndex(key.Convert(target.Type().Key()), out.Convert(target.Type().Elem()))
 						})
 					}
 
-					return vOf
+					return target
 				}
 			}
 		}
@@ -323,6 +722,57 @@ func (d *Decoder) decodeValue(elem *binaryElement, v any) any {
 	return nil
 }
 
+// decodeUnmarshaler calls the UnmarshalETF method of src, or of a pointer to it, with the raw term.
+func (d *Decoder) decodeUnmarshaler(elem *binaryElement, src reflect.Value) any {
+	u, out, ok := unmarshalerOf(src, typeOfUnmarshaler)
+	if !ok {
+		d.err = fmt.Errorf("error trying to decode into a no-addressable %s", src.Type())
+		return nil
+	}
+
+	data := make([]byte, 0, len(elem.raw)+1)
+	data = append(data, Version)
+	data = append(data, elem.raw...)
+	if err := u.(Unmarshaler).UnmarshalETF(data); err != nil {
+		d.err = err
+		return nil
+	}
+
+	return out.Interface()
+}
+
+// decodeTextUnmarshaler calls the UnmarshalText method of src, or of a pointer to it, with text.
+func (d *Decoder) decodeTextUnmarshaler(text []byte, src reflect.Value) any {
+	u, out, ok := unmarshalerOf(src, typeOfTextUnmarshaler)
+	if !ok {
+		d.err = fmt.Errorf("error trying to decode into a no-addressable %s", src.Type())
+		return nil
+	}
+
+	if err := u.(encoding.TextUnmarshaler).UnmarshalText(text); err != nil {
+		d.err = err
+		return nil
+	}
+
+	return out.Interface()
+}
+
+// decodeBinaryUnmarshaler calls the UnmarshalBinary method of src, or of a pointer to it, with bin.
+func (d *Decoder) decodeBinaryUnmarshaler(bin []byte, src reflect.Value) any {
+	u, out, ok := unmarshalerOf(src, typeOfBinaryUnmarshaler)
+	if !ok {
+		d.err = fmt.Errorf("error trying to decode into a no-addressable %s", src.Type())
+		return nil
+	}
+
+	if err := u.(encoding.BinaryUnmarshaler).UnmarshalBinary(bin); err != nil {
+		d.err = err
+		return nil
+	}
+
+	return out.Interface()
+}
+
 func (d *Decoder) decodeTuple(elem *binaryElement, src reflect.Value) any {
 	if src.Type().Kind() == reflect.Pointer {
 		src = derefValueOf(src.Elem())
@@ -380,7 +830,12 @@ func (d *Decoder) decodeAnyTuple(elem *binaryElement, src reflect.Value) any {
 		src = derefValueOf(src.Elem())
 	}
 
-	tuple := reflect.MakeSlice(src.Type(), len(elem.items), len(elem.items))
+	typ := reflect.SliceOf(src.Type())
+	if src.Type() == typeOfTerm {
+		typ = typeOfTuple
+	}
+
+	tuple := reflect.MakeSlice(typ, len(elem.items), len(elem.items))
 	for i, item := range elem.items {
 		tpElem := derefValueOf(tuple.Index(i))
 		if tpElem.IsValid() {
@@ -398,21 +853,25 @@ func (d *Decoder) decodeList(elem *binaryElement, src reflect.Value) any {
 	if src.Type().Kind() == reflect.Pointer {
 		src = derefValueOf(src.Elem())
 	}
-	if src.Type().Kind() != reflect.Array {
-		d.err = fmt.Errorf("error trying to decode a no-array type")
+	if src.Type().Kind() != reflect.Array && src.Type().Kind() != reflect.Slice {
+		d.err = fmt.Errorf("error trying to decode a no-array or no-slice type")
 		return nil
 	}
 
-	arrLength := 0
 	// Improper list check ([a | b])
-	if elem.items[len(elem.items)-1].tag != EttNil {
-		arrLength = len(elem.items)
-	} else {
-		arrLength = len(elem.items) - 1
+	if isImproperList(elem) {
+		d.err = fmt.Errorf("error trying to decode an improper list into a proper list type")
+		return nil
 	}
+	arrLength := len(elem.items) - 1
 
-	arrType := reflect.ArrayOf(arrLength, src.Type().Elem())
-	arr := reflect.New(arrType).Elem()
+	var arr reflect.Value
+	if src.Type().Kind() == reflect.Slice {
+		arr = makeSliceFrom(src, arrLength)
+	} else {
+		arrType := reflect.ArrayOf(arrLength, src.Type().Elem())
+		arr = reflect.New(arrType).Elem()
+	}
 
 	for i := 0; i < arrLength; i++ {
 		arrElem := arr.Index(i)
@@ -432,20 +891,49 @@ func (d *Decoder) decodeList(elem *binaryElement, src reflect.Value) any {
 	return arr.Interface()
 }
 
+// decodeCharList decodes a STRING_EXT element into a slice or array of numbers.
+func (d *Decoder) decodeCharList(elem *binaryElement, src reflect.Value) any {
+	if src.Type().Kind() == reflect.Pointer {
+		src = derefValueOf(src.Elem())
+	}
+
+	var arr reflect.Value
+	if src.Type().Kind() == reflect.Slice {
+		arr = makeSliceFrom(src, len(elem.body))
+	} else {
+		arr = reflect.New(reflect.ArrayOf(len(elem.body), src.Type().Elem())).Elem()
+	}
+
+	for i, b := range elem.body {
+		bOf := reflect.ValueOf(b)
+		if !bOf.CanConvert(arr.Type().Elem()) {
+			d.err = fmt.Errorf("error trying to decode a string into a %s", src.Type())
+			return nil
+		}
+
+		arr.Index(i).Set(bOf.Convert(arr.Type().Elem()))
+	}
+
+	return arr.Interface()
+}
+
 func (d *Decoder) decodeAnyList(elem *binaryElement, src reflect.Value) any {
 	if src.Type().Kind() == reflect.Pointer {
 		src = derefValueOf(src.Elem())
 	}
 
-	arrLength := 0
 	// Improper list check ([a | b])
-	if elem.items[len(elem.items)-1].tag != EttNil {
-		arrLength = len(elem.items)
-	} else {
-		arrLength = len(elem.items) - 1
+	if isImproperList(elem) {
+		return d.decodeImproperList(elem)
 	}
+	arrLength := len(elem.items) - 1
 
-	arr := reflect.MakeSlice(reflect.SliceOf(src.Type()), arrLength, arrLength)
+	typ := reflect.SliceOf(src.Type())
+	if src.Type() == typeOfTerm {
+		typ = typeOfList
+	}
+
+	arr := reflect.MakeSlice(typ, arrLength, arrLength)
 	for i := 0; i < arrLength; i++ {
 		arrElem := (arr).Index(i)
 		if arrElem.IsValid() {
@@ -460,6 +948,22 @@ func (d *Decoder) decodeAnyList(elem *binaryElement, src reflect.Value) any {
 	return arr.Interface()
 }
 
+// decodeImproperList decodes the elements and the tail of an improper list
+// into a ListImproper, keeping the tail as its last element.
+func (d *Decoder) decodeImproperList(elem *binaryElement) any {
+	if !isImproperList(elem) {
+		d.err = fmt.Errorf("error trying to decode a proper list into an improper list type")
+		return nil
+	}
+
+	list := make(ListImproper, len(elem.items))
+	for i, item := range elem.items {
+		list[i] = d.decodeValue(item, reflect.ValueOf(&list[i]).Elem())
+	}
+
+	return list
+}
+
 func (d *Decoder) decodeMap(elem *binaryElement, src reflect.Value) any {
 	if src.Type().Kind() == reflect.Pointer {
 		src = derefValueOf(src.Elem())
@@ -489,8 +993,8 @@ func (d *Decoder) decodeMap(elem *binaryElement, src reflect.Value) any {
 		value := d.decodeValue(valElem, valOf)
 
 		if key != nil && value != nil {
-			keyOf = valueOf(key)
-			valOf = valueOf(value)
+			keyOf = convertValueOf(valueOf(key), m.Type().Key())
+			valOf = convertValueOf(valueOf(value), m.Type().Elem())
 		}
 
 		if !valueOf(key).IsZero() && keyOf.IsValid() && valOf.IsValid() && !keyOf.IsZero() {
@@ -502,35 +1006,35 @@ func (d *Decoder) decodeMap(elem *binaryElement, src reflect.Value) any {
 }
 
 func (d *Decoder) decodeAnyMap(elem *binaryElement) any {
-	m := reflect.MakeMap(reflect.TypeOf(map[string]any{}))
-
-	for i := 0; i < len(elem.dict)-1; i += 2 {
-		keyElem := elem.dict[i]
-		valElem := elem.dict[i+1]
-
-		keyOf := reflect.New(m.Type().Key())
-		key := d.decodeValue(keyElem, keyOf)
-
-		valOf := reflect.New(m.Type().Elem())
-		val := d.decodeValue(valElem, valOf)
-
-		if keyOf.IsValid() && valOf.IsValid() {
-			if !keyOf.Comparable() && !valueOf(key).Comparable() {
-				panic("key of any map must be a comparable")
+	if d.config.Registry != nil {
+		if module, ok := d.parseElixirModule(elem); ok {
+			if t, ok := d.config.Registry.lookup(Atom(module)); ok {
+				return d.decodeStruct(elem, reflect.New(t))
 			}
+		}
+	}
 
-			if key != nil && val != nil {
-				keyOf = valueOf(key)
-				valOf = valueOf(val)
-			}
+	m := make(Map, len(elem.dict)/2)
+	for i := 0; i < len(elem.dict)-1; i += 2 {
+		var key, val Term
+		key = d.decodeValue(elem.dict[i], reflect.ValueOf(&key).Elem())
+		val = d.decodeValue(elem.dict[i+1], reflect.ValueOf(&val).Elem())
+		if d.err != nil {
+			return nil
+		}
 
-			if !keyOf.IsZero() && valOf.IsValid() {
-				m.SetMapIndex(keyOf, valOf)
-			}
+		// binaries, tuples, lists and maps can't be Go map keys, and integers are
+		// kept in one form whatever their encoding
+		if key != nil && !reflect.ValueOf(key).Comparable() {
+			key = d.keyOf(elem.dict[i])
+		} else {
+			key = integerKey(key)
 		}
+
+		m[key] = val
 	}
 
-	return m.Interface()
+	return m
 }
 
 func (d *Decoder) decodeStruct(elem *binaryElement, src reflect.Value) any {
@@ -540,9 +1044,21 @@ func (d *Decoder) decodeStruct(elem *binaryElement, src reflect.Value) any {
 	if src.Type().Kind() != reflect.Struct {
 		panic("error trying to decode a no-struct type")
 	}
-	fields := deepFieldsFrom(src)
+	if layout := structLayoutOf(src.Type()); layout.kind == layoutStruct {
+		if module, _ := d.parseElixirModule(elem); module != layout.name {
+			d.err = fmt.Errorf("decode error: %s expects the struct %s, got %q", src.Type(), layout.name, module)
+			return nil
+		}
+	}
+
+	list := deepFieldsFrom(src)
+	fields := map[string]structField{}
+	for _, f := range list {
+		fields[f.name] = f
+	}
 
 	str := ""
+	seen := map[string]bool{}
 	for i := 0; i < len(elem.dict); i += 2 {
 		keyElem := elem.dict[i]
 		valElem := elem.dict[i+1]
@@ -550,28 +1066,251 @@ func (d *Decoder) decodeStruct(elem *binaryElement, src reflect.Value) any {
 		keyOf := reflect.New(reflect.TypeOf(str)).Elem()
 		key := d.decodeValue(keyElem, keyOf)
 
-		if field, ok := fields[valueOf(key).String()]; ok {
-			// Decode nil pointer
-			if field.Type().Kind() == reflect.Pointer {
-				if slices.Equal(valElem.body, []byte{110, 105, 108}) {
-					field.SetZero()
-					continue
-				}
+		name := fmt.Sprint(key)
+		f, ok := fields[name]
+		if !ok {
+			if name == elixirStructKey && structLayoutOf(src.Type()).kind == layoutStruct {
+				continue
+			}
+
+			if d.config.DisallowUnknownFields {
+				d.err = fmt.Errorf("decode error: unknown key %q for %s", name, src.Type())
+				return nil
 			}
+			continue
+		}
+
+		seen[name] = true
+		if !d.decodeField(f, valElem) {
+			return nil
+		}
+	}
+
+	if !d.decodeMissingFields(src.Type(), list, seen) {
+		return nil
+	}
+
+	return src.Interface()
+}
+
+// decodeMissingFields sets the tag defaults of the fields whose keys weren't seen.
+// It returns false when one of them is required.
+func (d *Decoder) decodeMissingFields(t reflect.Type, fields []structField, seen map[string]bool) bool {
+	for _, f := range fields {
+		if seen[f.name] {
+			continue
+		}
+
+		if f.required {
+			d.err = fmt.Errorf("decode error: missing required key %q for %s", f.name, t)
+			return false
+		}
 
-			valOf := reflect.New(derefTypeOf(field.Type())).Elem()
-			val := d.decodeValue(valElem, valOf)
-			if val != nil {
-				valOf = valueOf(val)
+		if f.hasDefault {
+			if err := setDefault(f); err != nil {
+				d.err = err
+				return false
 			}
+		}
+	}
 
-			if keyOf.IsValid() && valOf.IsValid() {
-				setValueNotPtr(field.Type(), valOf, func(out reflect.Value) {
-					field.Set(out.Convert(field.Type()))
-				})
+	return true
+}
+
+// parseElixirModule returns the module of the __struct__ key of a map element.
+func (d *Decoder) parseElixirModule(elem *binaryElement) (string, bool) {
+	for i := 0; i+1 < len(elem.dict); i += 2 {
+		key, ok := d.parseWireElement(wireAtom, elem.dict[i])
+		if !ok || string(key) != elixirStructKey {
+			continue
+		}
+
+		module, ok := d.parseWireElement(wireAtom, elem.dict[i+1])
+		return string(module), ok
+	}
+
+	return "", false
+}
+
+// decodeRecord decodes a tuple into a struct declared as a record or a positional tuple,
+// checking its arity and tag atom.
+func (d *Decoder) decodeRecord(elem *binaryElement, src reflect.Value, layout structLayout) any {
+	src = indirectValueOf(src)
+	fields := deepFieldsFrom(src)
+
+	items := elem.items
+	if layout.kind == layoutRecord {
+		if len(items) != len(fields)+1 {
+			d.err = fmt.Errorf("decode error: record %s expects a tuple of arity %d, got %d", layout.name, len(fields)+1, len(items))
+			return nil
+		}
+
+		name, ok := d.parseWireElement(wireAtom, items[0])
+		if !ok || string(name) != layout.name {
+			d.err = fmt.Errorf("decode error: record %s expects the tag atom %s", src.Type(), layout.name)
+			return nil
+		}
+		items = items[1:]
+	} else if len(items) != len(fields) {
+		d.err = fmt.Errorf("decode error: %s expects a tuple of arity %d, got %d", src.Type(), len(fields), len(items))
+		return nil
+	}
+
+	for i, f := range fields {
+		if !d.decodeField(f, items[i]) {
+			return nil
+		}
+	}
+
+	return src.Interface()
+}
+
+// decodeProplistStruct decodes a list of {Name, Value} tuples and bare atoms into a struct
+// declared as a proplist. The first property with a name wins, like proplists:get_value/2.
+func (d *Decoder) decodeProplistStruct(elem *binaryElement, src reflect.Value) any {
+	if isImproperList(elem) {
+		d.err = fmt.Errorf("error trying to decode an improper list into a proplist")
+		return nil
+	}
+
+	src = indirectValueOf(src)
+	list := deepFieldsFrom(src)
+	fields := map[string]structField{}
+	for _, f := range list {
+		fields[f.name] = f
+	}
+
+	items := elem.items
+	if len(items) > 0 {
+		// skip the tail
+		items = items[:len(items)-1]
+	}
+
+	seen := map[string]bool{}
+	for _, item := range items {
+		key, value, ok := d.parseProperty(item)
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		f, ok := fields[key]
+		if !ok {
+			if d.config.DisallowUnknownFields {
+				d.err = fmt.Errorf("decode error: unknown key %q for %s", key, src.Type())
+				return nil
 			}
+			continue
+		}
+
+		if !d.decodeField(f, value) {
+			return nil
 		}
 	}
 
+	if !d.decodeMissingFields(src.Type(), list, seen) {
+		return nil
+	}
+
 	return src.Interface()
 }
+
+// decodeProplist decodes a list of {Key, Value} tuples and bare atoms into a Proplist.
+// Elements of any other shape are skipped, like the proplists module does.
+func (d *Decoder) decodeProplist(elem *binaryElement) any {
+	if isImproperList(elem) {
+		d.err = fmt.Errorf("error trying to decode an improper list into a proplist")
+		return nil
+	}
+
+	props := Proplist{}
+	for i := 0; i < len(elem.items)-1; i++ {
+		key, value, ok := d.parseProperty(elem.items[i])
+		if !ok {
+			continue
+		}
+
+		valOf := reflect.New(typeOfTerm).Elem()
+		if val := d.decodeValue(value, valOf); val != nil {
+			valOf.Set(valueOf(val))
+		}
+		props = append(props, Property{Key: Atom(key), Value: valOf.Interface()})
+	}
+
+	return props
+}
+
+// parseProperty returns the key and the value element of a proplist element,
+// which is either a {Key, Value} tuple or a bare atom standing for {Atom, true}.
+func (d *Decoder) parseProperty(elem *binaryElement) (string, *binaryElement, bool) {
+	if _, ok := d.parseWireElement(wireAtom, elem); ok {
+		return d.parseAtom(elem), trueElement, true
+	}
+
+	if elem.tag != EttSmallTuple || len(elem.items) != 2 {
+		return "", nil, false
+	}
+
+	if _, ok := d.parseWireElement(wireAtom, elem.items[0]); !ok {
+		return "", nil, false
+	}
+
+	return d.parseAtom(elem.items[0]), elem.items[1], true
+}
+
+// decodeField decodes elem into the struct field f. It returns false when the value can't be decoded.
+func (d *Decoder) decodeField(f structField, elem *binaryElement) bool {
+	field := f.value
+
+	// Decode nil pointer
+	if field.Type().Kind() == reflect.Pointer {
+		if slices.Equal(elem.body, []byte{110, 105, 108}) {
+			field.SetZero()
+			return true
+		}
+	}
+
+	valOf := reflect.New(derefTypeOf(field.Type())).Elem()
+
+	var val any
+	if f.wire != "" {
+		val = d.decodeWireField(f, elem, valOf)
+		if val == nil {
+			return false
+		}
+	} else {
+		val = d.decodeValue(elem, valOf)
+	}
+
+	if val != nil {
+		valOf = valueOf(val)
+	}
+
+	if valOf.IsValid() {
+		setValueNotPtr(field.Type(), valOf, func(out reflect.Value) {
+			field.Set(out.Convert(field.Type()))
+		})
+	}
+
+	return true
+}
+
+// decodeWireField decodes elem into src, a string or byte slice, checking that it's
+// the wire type required by the field tag.
+func (d *Decoder) decodeWireField(f structField, elem *binaryElement, src reflect.Value) any {
+	text, ok := d.parseWireElement(f.wire, elem)
+	if !ok {
+		d.err = fmt.Errorf("decode error: field %s expects %s, got %s", f.name, f.wire, TagString(elem.tag))
+		return nil
+	}
+
+	switch {
+	case src.Kind() == reflect.String:
+		return valueOf(string(text)).Convert(src.Type()).Interface()
+	case src.Kind() == reflect.Slice && src.Type().Elem().Kind() == reflect.Uint8:
+		return valueOf(bytes.Clone(text)).Convert(src.Type()).Interface()
+	}
+
+	d.err = fmt.Errorf("decode error: field %s of type %s can't be decoded as %s", f.name, src.Type(), f.wire)
+	return nil
+}
@@ -15,8 +15,30 @@ func DefaultDecoderConfig() *DecoderConfig {
 	}
 }
 
+// A DecoderConfig struct to handle decoding.
+//
+// The limits are meant for untrusted input, like binary_to_term/2 with the safe option.
+// A zero limit means no limit, and going over one returns a *LimitError.
 type DecoderConfig struct {
 	CacheSize int
+	// Go structs to decode Elixir structs into interfaces with
+	Registry *Registry
+	// Maximum size in bytes of the input read by a Decode call, counting inflated terms
+	MaxInputSize int
+	// Maximum nesting depth of tuples, lists, maps and funs
+	MaxDepth int
+	// Maximum number of elements of a tuple, list or string, pairs of a map, or free variables of a fun
+	MaxCollectionLen int
+	// Maximum size in bytes of a binary, bitstring or big integer
+	MaxBinarySize int
+	// Maximum number of distinct atoms in a Decode call. Decoders with this limit don't share their atom cache
+	MaxNewAtoms int
+	// Atoms allowed in the input, besides true, false and nil. Nil allows any atom
+	AllowedAtoms []Atom
+	// Reject funs and external funs with ErrFunRejected
+	RejectFuns bool
+	// Fail on map and proplist keys that don't match a field of the struct decoded into
+	DisallowUnknownFields bool
 }
 
 // WithCacheSize tells the decoder to an specific size for the internal cache.
@@ -27,3 +49,95 @@ func WithCacheSize(size int) DecoderOpt {
 		ec.CacheSize = size
 	}
 }
+
+// WithMaxInputSize tells the decoder to read at most size bytes in a Decode call,
+// counting the inflated size of compressed terms.
+//
+// MaxInputSize default value is 0, which means no limit.
+func WithMaxInputSize(size int) DecoderOpt {
+	return func(ec *DecoderConfig) {
+		ec.MaxInputSize = size
+	}
+}
+
+// WithMaxDepth tells the decoder to nest tuples, lists, maps and funs at most depth levels deep.
+//
+// MaxDepth default value is 0, which means no limit.
+func WithMaxDepth(depth int) DecoderOpt {
+	return func(ec *DecoderConfig) {
+		ec.MaxDepth = depth
+	}
+}
+
+// WithMaxCollectionLen tells the decoder to read tuples, lists, strings, maps and
+// the free variables of funs with at most n elements, or pairs for maps.
+//
+// MaxCollectionLen default value is 0, which means no limit.
+func WithMaxCollectionLen(n int) DecoderOpt {
+	return func(ec *DecoderConfig) {
+		ec.MaxCollectionLen = n
+	}
+}
+
+// WithMaxBinarySize tells the decoder to read binaries, bitstrings and big integers
+// of at most size bytes.
+//
+// MaxBinarySize default value is 0, which means no limit.
+func WithMaxBinarySize(size int) DecoderOpt {
+	return func(ec *DecoderConfig) {
+		ec.MaxBinarySize = size
+	}
+}
+
+// WithMaxNewAtoms tells the decoder to accept at most n distinct atoms in a Decode call,
+// whether they were seen before or not. A term over the limit adds no atom to the cache.
+//
+// The limit is per call. To keep untrusted input from growing the atom cache shared by
+// decoders, a decoder with this limit keeps its atoms in a cache of its own, which lives
+// as long as the decoder: a long-lived Decoder still gains up to n atoms per call.
+//
+// MaxNewAtoms default value is 0, which means no limit.
+func WithMaxNewAtoms(n int) DecoderOpt {
+	return func(ec *DecoderConfig) {
+		ec.MaxNewAtoms = n
+	}
+}
+
+// WithAllowedAtoms tells the decoder to only accept the given atoms, besides true, false
+// and nil. Any other atom returns an *AtomError.
+//
+// AllowedAtoms default value is nil, which allows any atom.
+func WithAllowedAtoms(atoms ...Atom) DecoderOpt {
+	return func(ec *DecoderConfig) {
+		ec.AllowedAtoms = atoms
+	}
+}
+
+// WithRejectFuns tells the decoder to return ErrFunRejected for funs and external funs.
+//
+// RejectFuns default value is false.
+func WithRejectFuns(b bool) DecoderOpt {
+	return func(ec *DecoderConfig) {
+		ec.RejectFuns = b
+	}
+}
+
+// WithDisallowUnknownFields tells the decoder to return an error when a map or proplist
+// decoded into a struct has a key that doesn't match any of its fields.
+//
+// DisallowUnknownFields default value is false.
+func WithDisallowUnknownFields(b bool) DecoderOpt {
+	return func(ec *DecoderConfig) {
+		ec.DisallowUnknownFields = b
+	}
+}
+
+// WithRegistry tells the decoder to decode Elixir structs into interfaces
+// as the Go structs registered for their modules.
+//
+// Registry default value is nil, which decodes Elixir structs into interfaces as maps.
+func WithRegistry(r *Registry) DecoderOpt {
+	return func(ec *DecoderConfig) {
+		ec.Registry = r
+	}
+}
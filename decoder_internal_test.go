@@ -0,0 +1,43 @@
+package goetf
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecoderNewAtomsCache(t *testing.T) {
+	{
+		// {a, b, c}
+		b := []byte{131, 104, 3, 119, 1, 97, 119, 1, 98, 119, 1, 99}
+
+		d := NewDecoder(bytes.NewReader(b), WithCacheSize(64), WithMaxNewAtoms(2))
+
+		var out any
+		var limitErr *LimitError
+		if err := d.Decode(&out); !errors.As(err, &limitErr) || limitErr.Limit != "MaxNewAtoms" {
+			t.Fatalf("want a MaxNewAtoms limit error got = %v", err)
+		}
+
+		// a term over the limit leaves the cache untouched
+		if n := d.cache.Len(); n != 0 {
+			t.Errorf("cache error: want = %v atoms got = %v", 0, n)
+		}
+	}
+	{
+		// messages under the limit leave the shared cache untouched
+		shared := defaultInternalCache.Len()
+		for _, name := range []string{"untrusted_1", "untrusted_2", "untrusted_3"} {
+			b := append([]byte{131, 119, byte(len(name))}, name...)
+
+			var out any
+			if err := Unmarshal(b, &out, WithMaxNewAtoms(1)); err != nil {
+				t.Fatal("unmarshal error:", err)
+			}
+		}
+
+		if n := defaultInternalCache.Len(); n != shared {
+			t.Errorf("cache error: want = %v atoms got = %v", shared, n)
+		}
+	}
+}
@@ -1,8 +1,18 @@
 package goetf_test
 
 import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
 	"maps"
+	"math/big"
+	"net/netip"
+	"reflect"
+	"runtime"
 	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/nicolito128/goetf"
@@ -77,7 +87,7 @@ func TestDecodeBig(t *testing.T) {
 			t.Errorf("want = %v, got = %v", want, out)
 		}
 	}
-	/*{
+	{
 		want := big.NewInt(314159265359)
 
 		b, err := goetf.Marshal(want)
@@ -93,7 +103,55 @@ func TestDecodeBig(t *testing.T) {
 		if want.Cmp(out) != 0 {
 			t.Errorf("want = %v, got = %v", want, out)
 		}
-	}*/
+	}
+	{ // wider than 64 bits
+		want, _ := new(big.Int).SetString("-340282366920938463463374607431768211457", 10)
+
+		b, err := goetf.Marshal(want)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		var out *big.Int
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out == nil || want.Cmp(out) != 0 {
+			t.Errorf("want = %v, got = %v", want, out)
+		}
+
+		var term any
+		if err := goetf.Unmarshal(b, &term); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if n, ok := term.(*big.Int); !ok || want.Cmp(n) != 0 {
+			t.Errorf("want = %v, got = %v", want, term)
+		}
+
+		var small int64
+		if err := goetf.Unmarshal(b, &small); err == nil {
+			t.Errorf("want overflow error, got = %v", small)
+		}
+	}
+	{ // between 2^63 and 2^64
+		b := []byte{131, 110, 8, 0, 0, 0, 0, 0, 0, 0, 0, 128}
+
+		var out uint64
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if want := uint64(1 << 63); want != out {
+			t.Errorf("want = %v, got = %v", want, out)
+		}
+
+		var signed int64
+		if err := goetf.Unmarshal(b, &signed); err == nil {
+			t.Errorf("want overflow error, got = %v", signed)
+		}
+	}
 }
 
 func TestDecodeSmallAtom(t *testing.T) {
@@ -255,8 +313,8 @@ func TestDecodeTuples(t *testing.T) {
 		w1 := (want[0]).(float64)
 		w3 := (want[2]).(string)
 		o1 := (out[0]).(float64)
-		o3 := (out[2]).(string)
-		if w1 != o1 || w3 != o3 {
+		o3 := (out[2]).(goetf.Atom)
+		if w1 != o1 || w3 != string(o3) {
 			t.Errorf("unmarshal error: want = %v got = %v", want, out)
 		}
 	}
@@ -632,3 +690,1181 @@ func TestDecodeStruct(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodePid(t *testing.T) {
+	want := goetf.Pid{Node: "nonode@nohost", ID: 84, Serial: 0, Creation: 3}
+	node := []byte{119, 13, 110, 111, 110, 111, 100, 101, 64, 110, 111, 104, 111, 115, 116}
+	{ // PID_EXT
+		b := append([]byte{131, 103}, node...)
+		b = append(b, 0, 0, 0, 84, 0, 0, 0, 0, 3)
+
+		var out goetf.Pid
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if want != out {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{ // NEW_PID_EXT
+		b := append([]byte{131, 88}, node...)
+		b = append(b, 0, 0, 0, 84, 0, 0, 0, 0, 0, 0, 0, 3)
+
+		var out *goetf.Pid
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out == nil || want != *out {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{ // any
+		b, err := goetf.Marshal(want)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		var out any
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if pid, ok := out.(goetf.Pid); !ok || want != pid {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{ // struct field
+		type proc struct {
+			Pid  goetf.Pid  `etf:"pid"`
+			Link *goetf.Pid `etf:"link"`
+		}
+
+		b, err := goetf.Marshal(proc{Pid: want, Link: &want})
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		var out proc
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if want != out.Pid || out.Link == nil || want != *out.Link {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{ // the zero Pid and Port, with the empty node atom ''
+		for _, want := range []any{goetf.Pid{}, goetf.Port{}} {
+			b, err := goetf.Marshal(want)
+			if err != nil {
+				t.Fatal("marshal error:", err)
+			}
+
+			var out any
+			if err := goetf.Unmarshal(b, &out); err != nil {
+				t.Fatal("unmarshal error:", err)
+			}
+
+			if want != out {
+				t.Errorf("unmarshal error: want = %#v got = %#v", want, out)
+			}
+		}
+	}
+}
+
+func TestDecodePort(t *testing.T) {
+	node := []byte{119, 3, 97, 64, 98}
+	tests := []struct {
+		data []byte
+		want goetf.Port
+	}{
+		{ // PORT_EXT
+			data: append(append([]byte{131, 102}, node...), 0, 0, 0, 7, 2),
+			want: goetf.Port{Node: "a@b", ID: 7, Creation: 2},
+		},
+		{ // NEW_PORT_EXT
+			data: append(append([]byte{131, 89}, node...), 0, 0, 0, 7, 1, 0, 0, 0),
+			want: goetf.Port{Node: "a@b", ID: 7, Creation: 1 << 24},
+		},
+		{ // V4_PORT_EXT
+			data: append(append([]byte{131, 120}, node...), 1, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 2),
+			want: goetf.Port{Node: "a@b", ID: 1<<56 | 7, Creation: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		var out goetf.Port
+		if err := goetf.Unmarshal(tt.data, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if tt.want != out {
+			t.Errorf("unmarshal error: want = %v got = %v", tt.want, out)
+		}
+
+		b, err := goetf.Marshal(out)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if !slices.Equal(tt.data, b) {
+			t.Errorf("marshal error: want = %v got = %v", tt.data, b)
+		}
+	}
+}
+
+func TestDecodeRef(t *testing.T) {
+	node := []byte{119, 3, 97, 64, 98}
+	{ // REFERENCE_EXT
+		b := append(append([]byte{131, 101}, node...), 0, 0, 0, 9, 1)
+
+		var out goetf.Ref
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		want := goetf.Ref{Node: "a@b", Creation: 1, ID: [5]uint32{9}, Len: 1}
+		if want != out {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{ // NEW_REFERENCE_EXT
+		b := append(append([]byte{131, 114, 0, 2}, node...), 3, 0, 0, 0, 9, 0, 0, 0, 10)
+
+		var out goetf.Ref
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		want := goetf.Ref{Node: "a@b", Creation: 3, ID: [5]uint32{9, 10}, Len: 2}
+		if want != out {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+
+		// it's written back as NEWER_REFERENCE_EXT, with a 32-bit creation
+		got, err := goetf.Marshal(out)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		newer := append(append([]byte{131, 90, 0, 2}, node...), 0, 0, 0, 3, 0, 0, 0, 9, 0, 0, 0, 10)
+		if !slices.Equal(newer, got) {
+			t.Errorf("marshal error: want = %v got = %v", newer, got)
+		}
+	}
+	{ // NEWER_REFERENCE_EXT, {Ref, ok}
+		b := append(append([]byte{131, 104, 2, 90, 0, 4}, node...),
+			0, 0, 0, 3, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 4, 119, 2, 111, 107)
+
+		out := make([]any, 0)
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		want := goetf.Ref{Node: "a@b", Creation: 3, ID: [5]uint32{1, 2, 3, 4}, Len: 4}
+		if len(out) != 2 || out[0] != want || out[1] != goetf.Atom("ok") {
+			t.Fatalf("unmarshal error: want = %v got = %v", want, out)
+		}
+
+		got, err := goetf.Marshal(out)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if !slices.Equal(b, got) {
+			t.Errorf("marshal error: want = %v got = %v", b, got)
+		}
+	}
+	{ // too many words
+		b := append([]byte{131, 90, 0, 6}, node...)
+
+		var out goetf.Ref
+		if err := goetf.Unmarshal(b, &out); err == nil {
+			t.Errorf("unmarshal error: expected error, got = %v", out)
+		}
+	}
+}
+
+func TestDecodeFunction(t *testing.T) {
+	pid := []byte{88, 119, 3, 97, 64, 98, 0, 0, 0, 85, 0, 0, 0, 0, 0, 0, 0, 1}
+	{ // NEW_FUN_EXT
+		body := []byte{1, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 0, 0, 0, 2, 0, 0, 0, 2, 119, 1, 109, 97, 2, 98, 0, 1, 0, 0}
+		body = append(body, pid...)
+		body = append(body, 97, 7, 119, 2, 111, 107)
+
+		b := append([]byte{131, 112, 0, 0, 0, byte(len(body) + 4)}, body...)
+
+		var out goetf.Function
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out.Arity != 1 || out.Unique[15] != 16 || out.Index != 2 || out.Module != "m" ||
+			out.OldIndex != 2 || out.OldUnique != 65536 || out.Pid.ID != 85 || len(out.FreeVars) != 2 {
+			t.Fatalf("unmarshal error: got = %+v", out)
+		}
+
+		if out.FreeVars[0] != uint8(7) || out.FreeVars[1] != goetf.Atom("ok") {
+			t.Errorf("unmarshal error: got free vars = %v", out.FreeVars)
+		}
+
+		got, err := goetf.Marshal(out)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if !slices.Equal(b, got) {
+			t.Errorf("marshal error: want = %v got = %v", b, got)
+		}
+	}
+	{ // FUN_EXT
+		b := append([]byte{131, 117, 0, 0, 0, 1}, pid...)
+		b = append(b, 119, 1, 109, 97, 3, 98, 0, 1, 0, 0, 97, 9)
+
+		var out any
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		fun, ok := out.(goetf.Function)
+		if !ok || fun.Module != "m" || fun.OldIndex != 3 || fun.OldUnique != 65536 || len(fun.FreeVars) != 1 {
+			t.Fatalf("unmarshal error: got = %+v", out)
+		}
+
+		got, err := goetf.Marshal(fun)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if !slices.Equal(b, got) {
+			t.Errorf("marshal error: want = %v got = %v", b, got)
+		}
+	}
+}
+
+func TestDecodeExport(t *testing.T) {
+	// fun lists:map/2
+	b := []byte{131, 113, 119, 5, 108, 105, 115, 116, 115, 119, 3, 109, 97, 112, 97, 2}
+	want := goetf.Export{Module: "lists", Function: "map", Arity: 2}
+
+	var out goetf.Export
+	if err := goetf.Unmarshal(b, &out); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+
+	if want != out {
+		t.Errorf("unmarshal error: want = %v got = %v", want, out)
+	}
+
+	got, err := goetf.Marshal(out)
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+
+	if !slices.Equal(b, got) {
+		t.Errorf("marshal error: want = %v got = %v", b, got)
+	}
+
+	// ATOM_EXT parts are accepted too
+	b = []byte{131, 113, 100, 0, 5, 108, 105, 115, 116, 115, 100, 0, 3, 109, 97, 112, 97, 2}
+
+	var term any
+	if err := goetf.Unmarshal(b, &term); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+
+	if term != want {
+		t.Errorf("unmarshal error: want = %v got = %v", want, term)
+	}
+}
+
+func TestDecodeImproperList(t *testing.T) {
+	// [a, b | c]
+	improper := []byte{131, 108, 0, 0, 0, 2, 119, 1, 97, 119, 1, 98, 119, 1, 99}
+	// [a, b, c]
+	proper := []byte{131, 108, 0, 0, 0, 3, 119, 1, 97, 119, 1, 98, 119, 1, 99, 106}
+	{
+		var out goetf.ListImproper
+		if err := goetf.Unmarshal(improper, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		want := goetf.ListImproper{goetf.Atom("a"), goetf.Atom("b"), goetf.Atom("c")}
+		if !slices.Equal(want, out) {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+
+		got, err := goetf.Marshal(out)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if !slices.Equal(improper, got) {
+			t.Errorf("marshal error: want = %v got = %v", improper, got)
+		}
+	}
+	{
+		var out any
+		if err := goetf.Unmarshal(improper, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if _, ok := out.(goetf.ListImproper); !ok {
+			t.Errorf("unmarshal error: want a ListImproper got = %T", out)
+		}
+
+		if err := goetf.Unmarshal(proper, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if _, ok := out.(goetf.ListImproper); ok {
+			t.Errorf("unmarshal error: proper list decoded as a ListImproper")
+		}
+	}
+	{ // the tail is never confused with an element
+		var arr [3]string
+		if err := goetf.Unmarshal(improper, &arr); err == nil {
+			t.Errorf("unmarshal error: expected error, got = %v", arr)
+		}
+
+		var out goetf.ListImproper
+		if err := goetf.Unmarshal(proper, &out); err == nil {
+			t.Errorf("unmarshal error: expected error, got = %v", out)
+		}
+	}
+}
+
+func TestDecodeListIntoSlice(t *testing.T) {
+	{ // [1, 2, 3] is sent as STRING_EXT
+		b := []byte{131, 107, 0, 3, 1, 2, 3}
+
+		var out []int
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if want := []int{1, 2, 3}; !slices.Equal(want, out) {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{ // [256, 1024]
+		b := []byte{131, 108, 0, 0, 0, 2, 98, 0, 0, 1, 0, 98, 0, 0, 4, 0, 106}
+
+		out := make([]int, 1, 8)
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if want := []int{256, 1024}; !slices.Equal(want, out) || cap(out) != 8 {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{
+		want := [3]string{"a", "b", "c"}
+		b, err := goetf.Marshal(want)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		var out []string
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if !slices.Equal(want[:], out) {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{ // []
+		var out []string
+		if err := goetf.Unmarshal([]byte{131, 106}, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out == nil || len(out) != 0 {
+			t.Errorf("unmarshal error: want = [] got = %v", out)
+		}
+	}
+	{ // lists of structs and nested lists
+		type point struct {
+			X int `etf:"x"`
+			Y int `etf:"y"`
+		}
+
+		type shape struct {
+			Points []point   `etf:"points"`
+			Tags   [][]int   `etf:"tags"`
+			Refs   []*point  `etf:"refs"`
+			Names  []string  `etf:"names"`
+			Empty  []float64 `etf:"empty"`
+		}
+
+		want := struct {
+			Points [2]point   `etf:"points"`
+			Tags   [2][2]int  `etf:"tags"`
+			Refs   [1]*point  `etf:"refs"`
+			Names  [2]string  `etf:"names"`
+			Empty  [0]float64 `etf:"empty"`
+		}{
+			Points: [2]point{{1, 2}, {3, 4}},
+			Tags:   [2][2]int{{300, 301}, {302, 303}},
+			Refs:   [1]*point{{5, 6}},
+			Names:  [2]string{"a", "b"},
+		}
+
+		b, err := goetf.Marshal(want)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		var out shape
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if !slices.Equal(want.Points[:], out.Points) || len(out.Tags) != 2 ||
+			!slices.Equal(want.Tags[1][:], out.Tags[1]) || len(out.Refs) != 1 ||
+			*out.Refs[0] != *want.Refs[0] || !slices.Equal(want.Names[:], out.Names) {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+}
+
+func TestDecodeLegacyFloat(t *testing.T) {
+	// term_to_binary(-3.14, [{minor_version, 0}])
+	b := append([]byte{131, 99}, []byte("-3.14000000000000012434e+00")...)
+	b = append(b, 0, 0, 0, 0)
+
+	var out float64
+	if err := goetf.Unmarshal(b, &out); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+
+	if want := -3.14; want != out {
+		t.Errorf("unmarshal error: want = %v got = %v", want, out)
+	}
+
+	var f32 float32
+	if err := goetf.Unmarshal(b, &f32); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+
+	if want := float32(-3.14); want != f32 {
+		t.Errorf("unmarshal error: want = %v got = %v", want, f32)
+	}
+
+	b[3] = 'x'
+	if err := goetf.Unmarshal(b, &out); err == nil {
+		t.Errorf("unmarshal error: expected error, got = %v", out)
+	}
+}
+
+func TestDecodePartialBitBinary(t *testing.T) {
+	// <<1:3>>
+	b := []byte{131, 77, 0, 0, 0, 1, 3, 32}
+	want := goetf.BitString{Bytes: []byte{32}, Bits: 3}
+	{
+		var out goetf.BitString
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if !slices.Equal(want.Bytes, out.Bytes) || want.Bits != out.Bits || out.BitLen() != 3 {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+
+		got, err := goetf.Marshal(out)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if !slices.Equal(b, got) {
+			t.Errorf("marshal error: want = %v got = %v", b, got)
+		}
+	}
+	{
+		var out any
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if bs, ok := out.(goetf.BitString); !ok || bs.Bits != 3 {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{ // bits would be lost
+		var out []byte
+		if err := goetf.Unmarshal(b, &out); err == nil {
+			t.Errorf("unmarshal error: expected error, got = %v", out)
+		}
+	}
+}
+
+func TestDecodeCompressed(t *testing.T) {
+	term := append([]byte{107, 0, 200}, bytes.Repeat([]byte{'e'}, 200)...)
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(term)
+	zw.Close()
+
+	b := append([]byte{131, 80, 0, 0, 0, byte(len(term))}, compressed.Bytes()...)
+	{
+		var out string
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if want := strings.Repeat("e", 200); want != out {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{ // wrong declared size
+		bad := slices.Clone(b)
+		bad[5]--
+
+		var out string
+		if err := goetf.Unmarshal(bad, &out); err == nil {
+			t.Errorf("unmarshal error: expected error, got = %v", out)
+		}
+	}
+	{ // a declared size of 2 GiB with an empty zlib stream
+		bad := []byte{131, 80, 0x7f, 0xff, 0xff, 0xff, 120, 156, 3, 0, 0, 0, 0, 1}
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		var out string
+		if err := goetf.Unmarshal(bad, &out); err == nil {
+			t.Errorf("unmarshal error: expected error, got = %v", out)
+		}
+
+		runtime.ReadMemStats(&after)
+		if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+			t.Errorf("unmarshal error: allocated %d bytes for an empty stream", alloc)
+		}
+	}
+}
+
+// celsius is sent as a charlist like "21.5C".
+type celsius float64
+
+func (c celsius) MarshalETF() ([]byte, error) {
+	return goetf.Marshal(strconv.FormatFloat(float64(c), 'f', 1, 64)+"C", goetf.WithStringOverAtom(true))
+}
+
+func (c *celsius) UnmarshalETF(data []byte) error {
+	var s string
+	if err := goetf.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "C"), 64)
+	if err != nil {
+		return err
+	}
+
+	*c = celsius(f)
+	return nil
+}
+
+func TestDecodeUnmarshaler(t *testing.T) {
+	{
+		b, err := goetf.Marshal(celsius(21.5))
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		want := []byte{131, 107, 0, 5, 50, 49, 46, 53, 67}
+		if !slices.Equal(want, b) {
+			t.Errorf("marshal error: want = %v got = %v", want, b)
+		}
+
+		var out celsius
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out != 21.5 {
+			t.Errorf("unmarshal error: want = %v got = %v", 21.5, out)
+		}
+	}
+	{
+		type reading struct {
+			Temp    celsius            `etf:"temp"`
+			Max     *celsius           `etf:"max"`
+			History [2]celsius         `etf:"history"`
+			Rooms   map[string]celsius `etf:"rooms"`
+		}
+
+		max := celsius(30)
+		want := reading{
+			Temp:    -4.5,
+			Max:     &max,
+			History: [2]celsius{1, 2},
+			Rooms:   map[string]celsius{"kitchen": 19.5},
+		}
+
+		b, err := goetf.Marshal(want)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		var out reading
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if want.Temp != out.Temp || out.Max == nil || *out.Max != max ||
+			want.History != out.History || out.Rooms["kitchen"] != 19.5 {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+}
+
+// serial is sent as its four big endian bytes.
+type serial uint32
+
+func (s serial) MarshalBinary() ([]byte, error) {
+	return []byte{byte(s >> 24), byte(s >> 16), byte(s >> 8), byte(s)}, nil
+}
+
+func (s *serial) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return fmt.Errorf("serial needs 4 bytes, got %d", len(data))
+	}
+
+	*s = serial(data[0])<<24 | serial(data[1])<<16 | serial(data[2])<<8 | serial(data[3])
+	return nil
+}
+
+func TestDecodeTextUnmarshaler(t *testing.T) {
+	{
+		// <<"10.0.0.1">>
+		b := []byte{131, 109, 0, 0, 0, 8, 49, 48, 46, 48, 46, 48, 46, 49}
+
+		var out netip.Addr
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		want := netip.MustParseAddr("10.0.0.1")
+		if out != want {
+			t.Errorf("unmarshal error: want = %v got = %v", want, out)
+		}
+	}
+	{
+		type host struct {
+			Addr   *netip.Addr `etf:"addr"`
+			Serial serial      `etf:"serial"`
+		}
+
+		// #{addr => "::1", serial => <<0, 0, 1, 2>>}
+		b := []byte{131, 116, 0, 0, 0, 2,
+			119, 4, 97, 100, 100, 114, 107, 0, 3, 58, 58, 49,
+			119, 6, 115, 101, 114, 105, 97, 108, 109, 0, 0, 0, 4, 0, 0, 1, 2,
+		}
+
+		var out host
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out.Addr == nil || *out.Addr != netip.IPv6Loopback() || out.Serial != 258 {
+			t.Errorf("unmarshal error: want = %v got = %v", host{&netip.Addr{}, 258}, out)
+		}
+	}
+	{
+		// [256] is the charlist "Ā", which is not an address
+		b := []byte{131, 108, 0, 0, 0, 1, 98, 0, 0, 1, 0, 106}
+
+		var out netip.Addr
+		if err := goetf.Unmarshal(b, &out); err == nil {
+			t.Errorf("unmarshal error: expected error, got = %v", out)
+		}
+	}
+}
+
+func TestDecodeStructTags(t *testing.T) {
+	type file struct {
+		Path  string `etf:"path,charlist"`
+		Owner []byte `etf:"owner,atom"`
+		Skip  int    `etf:"-"`
+	}
+
+	// #{path => [233, 8364], owner => root, 'Skip' => 1}
+	b := []byte{131, 116, 0, 0, 0, 3,
+		119, 4, 112, 97, 116, 104, 108, 0, 0, 0, 2, 97, 233, 98, 0, 0, 32, 172, 106,
+		119, 5, 111, 119, 110, 101, 114, 119, 4, 114, 111, 111, 116,
+		119, 4, 83, 107, 105, 112, 97, 1,
+	}
+
+	var out file
+	if err := goetf.Unmarshal(b, &out); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+
+	if out.Path != "é€" || string(out.Owner) != "root" || out.Skip != 0 {
+		t.Errorf("unmarshal error: want = %v got = %v", file{"é€", []byte("root"), 0}, out)
+	}
+}
+
+func TestDecodeProplist(t *testing.T) {
+	// [verbose, {timeout, 1}, {timeout, 2}, 5]
+	b := []byte{131, 108, 0, 0, 0, 4,
+		119, 7, 118, 101, 114, 98, 111, 115, 101,
+		104, 2, 119, 7, 116, 105, 109, 101, 111, 117, 116, 97, 1,
+		104, 2, 119, 7, 116, 105, 109, 101, 111, 117, 116, 97, 2,
+		97, 5,
+		106,
+	}
+	{
+		type options struct {
+			_       struct{} `etf:",proplist"`
+			Timeout int      `etf:"timeout"`
+			Verbose bool     `etf:"verbose"`
+		}
+
+		var out options
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out.Timeout != 1 || !out.Verbose {
+			t.Errorf("unmarshal error: want = %v got = %v", options{Timeout: 1, Verbose: true}, out)
+		}
+	}
+	{
+		var out goetf.Proplist
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if len(out) != 3 {
+			t.Fatalf("unmarshal error: want = %v properties got = %v", 3, out)
+		}
+
+		verbose, ok := out.Get("verbose")
+		if !ok || verbose != true {
+			t.Errorf("unmarshal error: want = %v got = %v", true, verbose)
+		}
+
+		timeout, ok := out.Get("timeout")
+		if !ok || timeout != uint8(1) {
+			t.Errorf("unmarshal error: want = %v got = %v", 1, timeout)
+		}
+	}
+}
+
+type elixirUser struct {
+	_    struct{} `etf:"Elixir.MyApp.User,struct"`
+	Name string   `etf:"name,binary"`
+}
+
+func TestDecodeElixirStruct(t *testing.T) {
+	// %MyApp.User{name: "Al"}
+	b := []byte{131, 116, 0, 0, 0, 2,
+		119, 10, 95, 95, 115, 116, 114, 117, 99, 116, 95, 95,
+		119, 17, 69, 108, 105, 120, 105, 114, 46, 77, 121, 65, 112, 112, 46, 85, 115, 101, 114,
+		119, 4, 110, 97, 109, 101, 109, 0, 0, 0, 2, 65, 108,
+	}
+	{
+		got, err := goetf.Marshal(elixirUser{Name: "Al"})
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if !slices.Equal(b, got) {
+			t.Errorf("marshal error: want = %v got = %v", b, got)
+		}
+
+		var out elixirUser
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out.Name != "Al" {
+			t.Errorf("unmarshal error: want = %v got = %v", "Al", out.Name)
+		}
+	}
+	{
+		reg := goetf.NewRegistry()
+		if err := reg.Register(&elixirUser{}); err != nil {
+			t.Fatal("register error:", err)
+		}
+
+		var out any
+		dec := goetf.NewDecoder(bytes.NewReader(b), goetf.WithRegistry(reg))
+		if err := dec.Decode(&out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if user, ok := out.(elixirUser); !ok || user.Name != "Al" {
+			t.Errorf("unmarshal error: want = %v got = %v", elixirUser{Name: "Al"}, out)
+		}
+	}
+	{
+		type admin struct {
+			_    struct{} `etf:"Elixir.MyApp.Admin,struct"`
+			Name string   `etf:"name,binary"`
+		}
+
+		var out admin
+		if err := goetf.Unmarshal(b, &out); err == nil {
+			t.Errorf("unmarshal error: expected error, got = %v", out)
+		}
+	}
+}
+
+func TestDecodeAnyKinds(t *testing.T) {
+	// {ok, <<"bin">>, "hé", [1, 2], []}
+	b := []byte{131, 104, 5,
+		119, 2, 111, 107,
+		109, 0, 0, 0, 3, 98, 105, 110,
+		107, 0, 2, 104, 233,
+		108, 0, 0, 0, 2, 97, 1, 97, 2, 106,
+		106,
+	}
+
+	var out any
+	if err := goetf.Unmarshal(b, &out); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+
+	want := goetf.Tuple{
+		goetf.Atom("ok"),
+		goetf.Binary("bin"),
+		goetf.Charlist("hé"),
+		goetf.List{uint8(1), uint8(2)},
+		goetf.List{},
+	}
+	if !reflect.DeepEqual(want, out) {
+		t.Errorf("unmarshal error: want = %#v got = %#v", want, out)
+	}
+
+	got, err := goetf.Marshal(out)
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+
+	if !slices.Equal(b, got) {
+		t.Errorf("marshal error: want = %v got = %v", b, got)
+	}
+}
+
+func TestDecodeTermTypes(t *testing.T) {
+	{
+		// #{a => ok}
+		b := []byte{131, 116, 0, 0, 0, 1, 119, 1, 97, 119, 2, 111, 107}
+
+		atoms := map[goetf.Atom]goetf.Atom{}
+		if err := goetf.Unmarshal(b, &atoms); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+		if atoms["a"] != "ok" {
+			t.Errorf("unmarshal error: want = %v got = %v", "ok", atoms)
+		}
+
+		anys := map[goetf.Atom]any{}
+		if err := goetf.Unmarshal(b, &anys); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+		if anys["a"] != goetf.Atom("ok") {
+			t.Errorf("unmarshal error: want = %v got = %v", "ok", anys)
+		}
+	}
+	{
+		// #{a => "hi", b => "yo"}
+		b := []byte{131, 116, 0, 0, 0, 2, 119, 1, 97, 107, 0, 2, 104, 105, 119, 1, 98, 107, 0, 2, 121, 111}
+
+		out := map[string]goetf.Charlist{}
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+		if out["a"] != "hi" || out["b"] != "yo" {
+			t.Errorf("unmarshal error: want = %v got = %v", "hi and yo", out)
+		}
+	}
+	{
+		var atom *goetf.Atom
+		if err := goetf.Unmarshal([]byte{131, 119, 2, 111, 107}, &atom); err != nil || atom == nil || *atom != "ok" {
+			t.Errorf("unmarshal error: want = %v got = %v (%v)", "ok", atom, err)
+		}
+
+		var charlist goetf.Charlist
+		if err := goetf.Unmarshal([]byte{131, 107, 0, 2, 104, 105}, &charlist); err != nil || charlist != "hi" {
+			t.Errorf("unmarshal error: want = %v got = %v (%v)", "hi", charlist, err)
+		}
+
+		var binary *goetf.Binary
+		if err := goetf.Unmarshal([]byte{131, 109, 0, 0, 0, 2, 104, 105}, &binary); err != nil || binary == nil || string(*binary) != "hi" {
+			t.Errorf("unmarshal error: want = %v got = %v (%v)", "hi", binary, err)
+		}
+	}
+}
+
+func TestDecodeAnyRoundTrip(t *testing.T) {
+	tests := map[string][]byte{
+		// #{a => {}, {n, 1} => [a|b], <<"id">> => 1}
+		"map": {131, 116, 0, 0, 0, 3,
+			119, 1, 97, 104, 0,
+			104, 2, 119, 1, 110, 97, 1, 108, 0, 0, 0, 1, 119, 1, 97, 119, 1, 98,
+			109, 0, 0, 0, 2, 105, 100, 97, 1,
+		},
+		// {#{}, [], <<1:3>>}
+		"empty": {131, 104, 3, 116, 0, 0, 0, 0, 106, 77, 0, 0, 0, 1, 3, 32},
+		// [<0.1.0>, fun m:f/1, 4294967296]
+		"list": {131, 108, 0, 0, 0, 3,
+			88, 119, 3, 97, 64, 98, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0,
+			113, 119, 1, 109, 119, 1, 102, 97, 1,
+			110, 8, 0, 0, 0, 0, 0, 1, 0, 0, 0,
+			106,
+		},
+		// nil, which decodes to a nil interface
+		"nil": {131, 119, 3, 110, 105, 108},
+	}
+
+	for name, b := range tests {
+		var out any
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatalf("%s: unmarshal error: %v", name, err)
+		}
+
+		got, err := goetf.Marshal(out, goetf.WithDeterministic(true))
+		if err != nil {
+			t.Fatalf("%s: marshal error: %v", name, err)
+		}
+
+		if !slices.Equal(b, got) {
+			t.Errorf("%s: want = %v got = %v (%#v)", name, b, got, out)
+		}
+	}
+
+	// atom and binary keys stay apart
+	b := []byte{131, 116, 0, 0, 0, 2, 119, 1, 107, 97, 1, 109, 0, 0, 0, 1, 107, 97, 2}
+	var out any
+	if err := goetf.Unmarshal(b, &out); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+
+	m, ok := out.(goetf.Map)
+	if !ok || len(m) != 2 || m[goetf.Atom("k")] != uint8(1) {
+		t.Errorf("unmarshal error: got = %#v", out)
+	}
+	// 'é' as a Latin-1 SMALL_ATOM_EXT comes back as the same atom in UTF-8
+	var atom any
+	if err := goetf.Unmarshal([]byte{131, 115, 1, 233}, &atom); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+	if atom != goetf.Atom("é") {
+		t.Errorf("unmarshal error: want = %#v got = %#v", goetf.Atom("é"), atom)
+	}
+
+	got, err := goetf.Marshal(atom)
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+	if want := []byte{131, 119, 2, 195, 169}; !slices.Equal(want, got) {
+		t.Errorf("marshal error: want = %v got = %v", want, got)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	limits := []struct {
+		name  string
+		data  []byte
+		opt   goetf.DecoderOpt
+		limit string
+	}{
+		// a binary that claims 4 GiB
+		{"binary", []byte{131, 109, 255, 255, 255, 255, 1}, goetf.WithMaxBinarySize(1024), "MaxBinarySize"},
+		{"input", []byte{131, 109, 0, 0, 0, 4, 1, 2, 3, 4}, goetf.WithMaxInputSize(8), "MaxInputSize"},
+		// a list that claims 4 billion elements
+		{"list", []byte{131, 108, 255, 255, 255, 255, 97, 1}, goetf.WithMaxCollectionLen(100), "MaxCollectionLen"},
+		{"map", []byte{131, 116, 0, 0, 0, 3}, goetf.WithMaxCollectionLen(2), "MaxCollectionLen"},
+		// {{{{}}}}
+		{"depth", []byte{131, 104, 1, 104, 1, 104, 1, 104, 0}, goetf.WithMaxDepth(3), "MaxDepth"},
+		// a compressed term that claims 4 GiB
+		{"compressed", []byte{131, 80, 255, 255, 255, 255, 120, 156}, goetf.WithMaxInputSize(1024), "MaxInputSize"},
+	}
+
+	for _, l := range limits {
+		var out any
+		err := goetf.Unmarshal(l.data, &out, l.opt)
+
+		var limitErr *goetf.LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != l.limit {
+			t.Errorf("%s: want a %s limit error got = %v", l.name, l.limit, err)
+		}
+	}
+
+	{
+		// {{{}}} is within a depth of 3
+		var out any
+		if err := goetf.Unmarshal([]byte{131, 104, 1, 104, 1, 104, 0}, &out, goetf.WithMaxDepth(3)); err != nil {
+			t.Error("unmarshal error:", err)
+		}
+	}
+	{
+		if _, err := goetf.ParseValue([]byte{131, 104, 1, 104, 1, 104, 0}, goetf.WithMaxDepth(3)); err != nil {
+			t.Error("parse error:", err)
+		}
+
+		var limitErr *goetf.LimitError
+		_, err := goetf.ParseValue([]byte{131, 104, 1, 104, 1, 104, 1, 104, 0}, goetf.WithMaxDepth(3))
+		if !errors.As(err, &limitErr) || limitErr.Limit != "MaxDepth" {
+			t.Errorf("want a MaxDepth limit error got = %v", err)
+		}
+
+		// a million nested tuples don't exhaust the stack
+		deep := []byte{131}
+		for i := 0; i < 1<<20; i++ {
+			deep = append(deep, 104, 1)
+		}
+		deep = append(deep, 104, 0)
+
+		if _, err := goetf.ParseValue(deep); err != nil {
+			t.Error("parse error:", err)
+		}
+
+		_, err = goetf.ParseValue(deep, goetf.WithMaxDepth(32))
+		if !errors.As(err, &limitErr) || limitErr.Limit != "MaxDepth" {
+			t.Errorf("want a MaxDepth limit error got = %v", err)
+		}
+	}
+	{
+		// {a, b, a, c}
+		b := []byte{131, 104, 4, 119, 1, 97, 119, 1, 98, 119, 1, 97, 119, 1, 99}
+
+		var out any
+		if err := goetf.Unmarshal(b, &out, goetf.WithCacheSize(64), goetf.WithMaxNewAtoms(3)); err != nil {
+			t.Error("unmarshal error:", err)
+		}
+
+		var limitErr *goetf.LimitError
+		err := goetf.Unmarshal(b, &out, goetf.WithCacheSize(64), goetf.WithMaxNewAtoms(2))
+		if !errors.As(err, &limitErr) || limitErr.Limit != "MaxNewAtoms" {
+			t.Errorf("want a MaxNewAtoms limit error got = %v", err)
+		}
+	}
+	{
+		// {ok, true}
+		var out any
+		if err := goetf.Unmarshal([]byte{131, 104, 2, 119, 2, 111, 107, 119, 4, 116, 114, 117, 101}, &out, goetf.WithAllowedAtoms("ok")); err != nil {
+			t.Error("unmarshal error:", err)
+		}
+
+		// {error}
+		var atomErr *goetf.AtomError
+		err := goetf.Unmarshal([]byte{131, 104, 1, 119, 5, 101, 114, 114, 111, 114}, &out, goetf.WithAllowedAtoms("ok"))
+		if !errors.As(err, &atomErr) || atomErr.Atom != "error" {
+			t.Errorf("want an atom error got = %v", err)
+		}
+	}
+	{
+		// [fun m:f/1]
+		b := []byte{131, 108, 0, 0, 0, 1, 113, 119, 1, 109, 119, 1, 102, 97, 1, 106}
+
+		var out any
+		if err := goetf.Unmarshal(b, &out, goetf.WithRejectFuns(true)); !errors.Is(err, goetf.ErrFunRejected) {
+			t.Errorf("want ErrFunRejected got = %v", err)
+		}
+	}
+	{
+		var limitErr *goetf.LimitError
+		_, err := goetf.ParseValue([]byte{131, 80, 255, 255, 255, 255, 120, 156}, goetf.WithMaxInputSize(1024))
+		if !errors.As(err, &limitErr) {
+			t.Errorf("want a limit error got = %v", err)
+		}
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	type account struct {
+		Name  string `etf:"name,binary,required"`
+		Role  string `etf:"role,atom,default=guest"`
+		Age   int    `etf:"age,default=18"`
+		Admin *bool  `etf:"admin,default=true"`
+	}
+
+	{
+		b, err := goetf.Marshal(goetf.Map{goetf.Atom("name"): goetf.Binary("ann")})
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		var out account
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out.Name != "ann" || out.Role != "guest" || out.Age != 18 || out.Admin == nil || !*out.Admin {
+			t.Errorf("unmarshal error: got = %+v", out)
+		}
+	}
+	{
+		b, err := goetf.Marshal(goetf.Map{goetf.Atom("role"): goetf.Atom("admin")})
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		var out account
+		if err := goetf.Unmarshal(b, &out); err == nil || !strings.Contains(err.Error(), `"name"`) {
+			t.Errorf("want a missing name error got = %v", err)
+		}
+	}
+	{
+		b, err := goetf.Marshal(goetf.Map{goetf.Atom("name"): goetf.Binary("ann"), goetf.Atom("email"): goetf.Binary("a@b")})
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		var out account
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		dec := goetf.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&out); err == nil || !strings.Contains(err.Error(), `"email"`) {
+			t.Errorf("want an unknown email error got = %v", err)
+		}
+	}
+	{
+		type options struct {
+			_       struct{} `etf:",proplist"`
+			Verbose bool     `etf:"verbose"`
+			Level   int      `etf:"level,default=3"`
+		}
+
+		// [verbose, debug]
+		b := []byte{131, 108, 0, 0, 0, 2, 119, 7, 118, 101, 114, 98, 111, 115, 101, 119, 5, 100, 101, 98, 117, 103, 106}
+
+		var out options
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if !out.Verbose || out.Level != 3 {
+			t.Errorf("unmarshal error: got = %+v", out)
+		}
+
+		if err := goetf.Unmarshal(b, &out, goetf.WithDisallowUnknownFields(true)); err == nil || !strings.Contains(err.Error(), `"debug"`) {
+			t.Errorf("want an unknown debug error got = %v", err)
+		}
+	}
+	{
+		// %MyApp.User{name: "Al"}
+		b, err := goetf.Marshal(elixirUser{Name: "Al"})
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		var out elixirUser
+		if err := goetf.Unmarshal(b, &out, goetf.WithDisallowUnknownFields(true)); err != nil || out.Name != "Al" {
+			t.Errorf("unmarshal error: got = %+v %v", out, err)
+		}
+	}
+}
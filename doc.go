@@ -35,6 +35,62 @@ Or use Unmarshal to decode the value:
 		fmt.Println("Output:", out)
 	}
 
+Values decoded into an interface keep their kind: atoms become Atom, binaries become Binary,
+strings become Charlist, tuples and lists become Tuple and List, and maps become Map, so they
+re-encode to the same term. Map keys that can't be Go map keys, like binaries or tuples, are
+held as a Key; Lookup and Store find them from ordinary terms like Tuple{Atom("node"), 1},
+and integer keys from any Go integer.
+Plain Go strings and slices follow the WithStringFormat and WithSliceFormat options.
+
+Structs are encoded as maps keyed by atoms. The "etf" tag of a field sets its key name,
+followed by options: "omitempty" skips the field when it's empty, and "atom", "binary" or
+"charlist" force the wire type of a string field. When decoding, "required" fails if the
+key of the field is missing, and "default=value" sets the field instead. A field tagged
+with "-" is ignored:
+
+	type User struct {
+		Name  string `etf:"name,binary,required"`
+		Role  string `etf:"role,atom,default=guest"`
+		Email string `etf:"email,omitempty"`
+		Token string `etf:"-"`
+	}
+
+Keys that don't match any field are skipped, unless the decoder is told to
+DisallowUnknownFields.
+
+A blank field declares a struct as a record, sent as a tuple headed by its tag atom with
+the fields in declaration order, or as a positional tuple without a tag:
+
+	type User struct {
+		_    struct{} `etf:"user,record"` // {user, Name, Age}
+		Name string
+		Age  int
+	}
+
+	type Endpoint struct {
+		_    struct{} `etf:",tuple"` // {Host, Port}
+		Host string
+		Port int
+	}
+
+Likewise, _ struct{} `etf:",proplist"` sends a struct as a proplist or keyword list,
+[{host, Host}, {port, Port}]. Use the Proplist type for proplists with arbitrary keys.
+
+An Elixir struct is a map with a __struct__ key holding its module. Declare it with
+_ struct{} `etf:"Elixir.MyApp.User,struct"`, so the key is written when encoding and checked
+when decoding. A Registry of those structs, passed with WithRegistry, decodes Elixir structs
+found in interfaces into their Go types.
+
+To decode untrusted input, set limits on the decoder, like binary_to_term/2 does with the
+safe option. Going over one returns a *LimitError before allocating for it:
+
+	err := goetf.Unmarshal(data, &out,
+		goetf.WithMaxInputSize(1<<20),
+		goetf.WithMaxDepth(32),
+		goetf.WithMaxNewAtoms(100),
+		goetf.WithRejectFuns(true),
+	)
+
 Alternatively, you can use the NewEncoder or NewDecoder functions to create your owns.
 */
 package goetf
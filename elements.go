@@ -11,6 +11,15 @@ type binaryElement struct {
 	items []*binaryElement
 	// dict hold the pairs for a map
 	dict []*binaryElement
+	// raw hold the encoded term, starting with its tag
+	raw []byte
+}
+
+// trueElement is the atom true, which a bare atom in a proplist stands for.
+var trueElement = &binaryElement{
+	tag:  EttSmallAtomUTF8,
+	body: []byte("true"),
+	raw:  []byte{EttSmallAtomUTF8, 4, 't', 'r', 'u', 'e'},
 }
 
 func newBinaryElement(tag ExternalTagType, body []byte) *binaryElement {
@@ -25,7 +34,10 @@ func newBinaryElement(tag ExternalTagType, body []byte) *binaryElement {
 
 func (be *binaryElement) append(tag ExternalTagType, elem *binaryElement) {
 	switch tag {
-	case EttList, EttSmallTuple, EttLargeTuple:
+	case EttList, EttSmallTuple, EttLargeTuple,
+		EttPid, EttNewPid, EttPort, EttNewPort, EttV4Port,
+		EttRef, EttNewReference, EttNewerReference,
+		EttNewFun, EttFun, EttExport:
 		be.items = append(be.items, elem)
 	case EttMap:
 		be.dict = append(be.dict, elem)
@@ -54,3 +66,8 @@ func isComplexType(tag ExternalTagType) bool {
 
 	return false
 }
+
+// isImproperList reports whether a list element has a tail other than NIL_EXT, like [a | b].
+func isImproperList(be *binaryElement) bool {
+	return be.tag == EttList && len(be.items) > 0 && be.items[len(be.items)-1].tag != EttNil
+}
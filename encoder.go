@@ -2,12 +2,15 @@ package goetf
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"math"
 	"math/big"
 	"reflect"
+	"slices"
 	"strings"
 	"unicode/utf8"
 )
@@ -15,11 +18,29 @@ import (
 var (
 	typeOfBytes  = reflect.TypeOf([]byte(nil))
 	typeOfBigInt = reflect.TypeOf(*big.NewInt(0))
+	typeOfPid    = reflect.TypeOf(Pid{})
+	typeOfPort   = reflect.TypeOf(Port{})
+	typeOfRef    = reflect.TypeOf(Ref{})
+	typeOfFun    = reflect.TypeOf(Function{})
+	typeOfExport = reflect.TypeOf(Export{})
+	typeOfBits   = reflect.TypeOf(BitString{})
+	typeOfKey    = reflect.TypeOf(Key{})
+
+	typeOfTerm         = reflect.TypeOf((*Term)(nil)).Elem()
+	typeOfAtom         = reflect.TypeOf(Atom(""))
+	typeOfCharlist     = reflect.TypeOf(Charlist(""))
+	typeOfBinary       = reflect.TypeOf(Binary{})
+	typeOfTuple        = reflect.TypeOf(Tuple{})
+	typeOfList         = reflect.TypeOf(List{})
+	typeOfProplist     = reflect.TypeOf(Proplist{})
+	typeOfListImproper = reflect.TypeOf(ListImproper{})
 )
 
 // Marshaler is the interface implemented by types that can marshal themselves into valid ETF.
+// MarshalETF returns the encoding of a single term, like the one returned by Marshal.
+// The leading version number is optional.
 type Marshaler interface {
-	MarshalETF(data []byte, src any) (err error)
+	MarshalETF() ([]byte, error)
 }
 
 // Marshal returns the ETF encoding of v.
@@ -72,6 +93,16 @@ func (e *Encoder) encode(v any) error {
 	vOf := valueOf(v)
 	e.stream.writeByte(131)
 
+	// Marshal(nil)
+	if !vOf.IsValid() {
+		e.writeNil()
+		return nil
+	}
+
+	if e.config.Compression > 0 {
+		return e.encodeCompressed(vOf)
+	}
+
 	err := e.parseType(vOf)
 	if err != nil {
 		return err
@@ -80,8 +111,75 @@ func (e *Encoder) encode(v any) error {
 	return nil
 }
 
+// encodeCompressed encodes src apart and writes it compressed when it's large enough
+// and compression makes it smaller, or as it is otherwise.
+func (e *Encoder) encodeCompressed(src reflect.Value) error {
+	if e.config.Compression > zlib.BestCompression {
+		return fmt.Errorf("encode error: invalid compression level %d", e.config.Compression)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0))
+	term := &Encoder{config: e.config, w: buf}
+	term.init()
+	if err := term.parseType(src); err != nil {
+		return err
+	}
+
+	data, err := term.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	if len(data) < e.config.CompressionMin {
+		e.writeBytes(data)
+		return nil
+	}
+
+	compressed := bytes.NewBuffer(make([]byte, 0))
+	zw, err := zlib.NewWriterLevel(compressed, e.config.Compression)
+	if err != nil {
+		return err
+	}
+
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if SizeCompressedSize+compressed.Len() >= len(data) {
+		e.writeBytes(data)
+		return nil
+	}
+
+	e.writeByte(EttCompressed)
+	e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(data))), compressed.Bytes())
+	return nil
+}
+
 // parseType parses the reflected value of src and writes its representation in bytes.
 func (e *Encoder) parseType(src reflect.Value) error {
+	if m, ok := marshalerOf(src, typeOfMarshaler); ok {
+		return e.writeMarshaler(m.(Marshaler))
+	}
+
+	// big.Int implements encoding.TextMarshaler, but it has its own terms
+	if src.IsValid() && derefTypeOf(src.Type()) != typeOfBigInt {
+		if m, ok := marshalerOf(src, typeOfTextMarshaler); ok {
+			return e.writeTextMarshaler(m.(encoding.TextMarshaler))
+		}
+
+		if m, ok := marshalerOf(src, typeOfBinaryMarshaler); ok {
+			data, err := m.(encoding.BinaryMarshaler).MarshalBinary()
+			if err != nil {
+				return err
+			}
+			return e.writeBinary(data)
+		}
+	}
+
 	var kind reflect.Kind
 	if src.IsValid() {
 		kind = src.Type().Kind()
@@ -107,9 +205,10 @@ func (e *Encoder) parseType(src reflect.Value) error {
 		data := binary.BigEndian.AppendUint16([]byte{0, 0}, unsigned)
 		e.writeBytes([]byte{EttInteger}, data)
 
-	case reflect.Int16:
-		integer := int16(src.Int())
-		data := binary.BigEndian.AppendUint16([]byte{0, 0}, uint16(integer))
+	case reflect.Int8, reflect.Int16:
+		// sign-extended to the 32 bits of INTEGER_EXT
+		integer := int32(src.Int())
+		data := binary.BigEndian.AppendUint32(make([]byte, 0), uint32(integer))
 		e.writeBytes([]byte{EttInteger}, data)
 
 	case reflect.Uint32:
@@ -147,28 +246,35 @@ func (e *Encoder) parseType(src reflect.Value) error {
 
 	case reflect.Float64, reflect.Float32:
 		float := src.Float()
+		if e.config.LegacyFloat {
+			return e.writeFloat(float)
+		}
+
 		data := binary.BigEndian.AppendUint64([]byte{}, math.Float64bits(float))
 		e.writeBytes([]byte{EttNewFloat}, data)
 
 	case reflect.String:
+		switch src.Type() {
+		case typeOfAtom:
+			return e.writeAtom(src.String())
+		case typeOfCharlist:
+			return e.writeCharlist(src.String())
+		}
+
 		str := src.String()
 		data := []byte(str)
-		isValidUTF8 := utf8.Valid(data)
-		blen := make([]byte, 0)
-
-		var tag ExternalTagType
-
-		validAtom := len(data) <= 255 && isValidUTF8 && !strings.Contains(str, " ")
-		if !e.config.StringOverAtom && validAtom {
-			blen = binary.BigEndian.AppendUint16(blen, uint16(len(data)))[1:]
-			tag = EttSmallAtomUTF8
-		} else {
-			blen = binary.BigEndian.AppendUint16(blen, uint16(len(data)))
-			tag = EttString
+		switch e.stringFormat() {
+		case StringAsBinary:
+			return e.writeBinary(data)
+		case StringAsCharlist:
+			return e.writeCharlist(str)
 		}
 
-		e.writeByte(tag)
-		e.writeBytes(blen, data)
+		validAtom := len(data) <= 255 && utf8.Valid(data) && !strings.Contains(str, " ")
+		if validAtom {
+			return e.writeAtom(str)
+		}
+		return e.writeCharlist(str)
 
 	case reflect.Bool:
 		b := src.Bool()
@@ -183,6 +289,18 @@ func (e *Encoder) parseType(src reflect.Value) error {
 		e.writeNil()
 
 	case reflect.Interface:
+		if !src.IsNil() && implementsMarshaler(src.Elem().Type()) {
+			return e.parseType(src.Elem())
+		}
+
+		// composite values, like the slices and maps the decoder produces for interfaces
+		if !src.IsNil() {
+			switch src.Elem().Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+				return e.parseType(src.Elem())
+			}
+		}
+
 		v := e.assertInterfaceType(src.Interface())
 		if v == nil {
 			e.writeNil()
@@ -211,6 +329,22 @@ func (e *Encoder) parseType(src reflect.Value) error {
 			break
 		}
 
+		if src.Type() == typeOfListImproper {
+			return e.writeImproperList(src.Interface().(ListImproper))
+		}
+
+		if src.Type() == typeOfProplist {
+			return e.writeProplist(src.Interface().(Proplist))
+		}
+
+		if src.Type() == typeOfBinary {
+			return e.writeBinary(src.Bytes())
+		}
+
+		if src.Type() == typeOfList || (src.Type() != typeOfTuple && e.config.SliceFormat == SliceAsList) {
+			return e.writeList(src)
+		}
+
 		tpLen, isLarge := src.Len(), false
 		if tpLen <= 255 {
 			e.writeByte(EttSmallTuple, byte(tpLen))
@@ -238,33 +372,20 @@ func (e *Encoder) parseType(src reflect.Value) error {
 		}
 
 	case reflect.Array:
-		e.writeByte(EttList)
-		arrLen := src.Len()
-
-		blen := make([]byte, 4)
-		binary.BigEndian.PutUint32(blen, uint32(arrLen))
-		e.writeBytes(blen)
-
-		for i := 0; i < arrLen; i++ {
-			elem := src.Index(i)
-			if elem.IsValid() {
-				if err := e.parseType(derefValueOf(elem)); err != nil {
-					return err
-				}
-
-				if elem.Type().Kind() == reflect.Pointer && elem.IsNil() {
-					e.writeNil()
-				}
-			}
-		}
-
-		e.writeByte(EttNil)
+		return e.writeList(src)
 
 	case reflect.Map:
 		e.writeByte(EttMap)
 		mapLen := src.Len()
 
 		keys := src.MapKeys()
+		if e.config.Deterministic {
+			sorted, err := e.sortMapKeys(keys)
+			if err != nil {
+				return err
+			}
+			keys = sorted
+		}
 
 		blen := binary.BigEndian.AppendUint32([]byte{}, uint32(mapLen))
 		e.writeBytes(blen)
@@ -288,22 +409,75 @@ func (e *Encoder) parseType(src reflect.Value) error {
 
 	case reflect.Struct:
 		if src.Type() == typeOfBigInt {
-			return e.writeLargeBig(src)
+			return e.writeBig(src)
+		}
+
+		if src.Type() == typeOfPid {
+			return e.writePid(src.Interface().(Pid))
+		}
+
+		if src.Type() == typeOfPort {
+			return e.writePort(src.Interface().(Port))
+		}
+
+		if src.Type() == typeOfRef {
+			return e.writeRef(src.Interface().(Ref))
+		}
+
+		if src.Type() == typeOfFun {
+			return e.writeFunction(src.Interface().(Function))
+		}
+
+		if src.Type() == typeOfExport {
+			return e.writeExport(src.Interface().(Export))
+		}
+
+		if src.Type() == typeOfBits {
+			return e.writeBitString(src.Interface().(BitString))
+		}
+
+		if src.Type() == typeOfKey {
+			k := src.Interface().(Key)
+			if k.term == "" {
+				return fmt.Errorf("encode error: empty Key, use NewKey to make one")
+			}
+			_, err := e.writeBytes([]byte(k.term))
+			return err
+		}
+
+		layout := structLayoutOf(src.Type())
+		switch layout.kind {
+		case layoutRecord, layoutTuple:
+			return e.writeRecord(src, layout)
+		case layoutProplist:
+			return e.writeProplistStruct(src)
 		}
 
 		e.writeByte(EttMap)
-		fields := deepFieldsFrom(src)
+		fields := slices.DeleteFunc(deepFieldsFrom(src), func(f structField) bool {
+			return f.omitEmpty && isEmptyValue(f.value)
+		})
 		length := len(fields)
+		if layout.kind == layoutStruct {
+			length++
+		}
 
 		blen := binary.BigEndian.AppendUint32([]byte{}, uint32(length))
 		e.writeBytes(blen)
 
-		for name, field := range fields {
-			if err := e.parseType(valueOf(name)); err != nil {
+		if layout.kind == layoutStruct {
+			e.writeAtom(elixirStructKey)
+			if err := e.writeAtom(layout.name); err != nil {
 				return err
 			}
+		}
 
-			if err := e.parseType(field); err != nil {
+		for _, field := range fields {
+			if err := e.writeAtom(field.name); err != nil {
+				return err
+			}
+
+			if err := e.writeField(field); err != nil {
 				return err
 			}
 		}
@@ -326,6 +500,250 @@ func (e *Encoder) parseBinary(src reflect.Value) {
 	}
 }
 
+// writeMarshaler writes the term returned by m, without its version number.
+func (e *Encoder) writeMarshaler(m Marshaler) error {
+	data, err := m.MarshalETF()
+	if err != nil {
+		return err
+	}
+
+	if len(data) > 0 && data[0] == Version {
+		data = data[1:]
+	}
+
+	if len(data) == 0 || !IsValidEtt(data[0]) {
+		return fmt.Errorf("encode error: MarshalETF returned an invalid term")
+	}
+
+	e.writeBytes(data)
+	return nil
+}
+
+// sortMapKeys sorts the keys of a map in Erlang term order, as they are encoded.
+func (e *Encoder) sortMapKeys(keys []reflect.Value) ([]reflect.Value, error) {
+	d, elems, err := readElementsOf(e.config, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(i, j int) int {
+		return d.compareElements(elems[i], elems[j], true)
+	})
+
+	sorted := make([]reflect.Value, len(keys))
+	for i, k := range order {
+		sorted[i] = keys[k]
+	}
+
+	return sorted, nil
+}
+
+// writeRecord writes the fields of src in declaration order as a tuple,
+// headed by the tag atom when the layout is a record.
+func (e *Encoder) writeRecord(src reflect.Value, layout structLayout) error {
+	fields := deepFieldsFrom(src)
+
+	arity := len(fields)
+	if layout.kind == layoutRecord {
+		if layout.name == "" {
+			return fmt.Errorf("encode error: record %s has no tag atom", src.Type())
+		}
+		arity++
+	}
+
+	e.writeTupleHeader(arity)
+	if layout.kind == layoutRecord {
+		if err := e.writeAtom(layout.name); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range fields {
+		if err := e.writeField(field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeProplistStruct writes the fields of src in declaration order as a list of {Name, Value} tuples.
+func (e *Encoder) writeProplistStruct(src reflect.Value) error {
+	fields := slices.DeleteFunc(deepFieldsFrom(src), func(f structField) bool {
+		return f.omitEmpty && isEmptyValue(f.value)
+	})
+
+	if len(fields) > 0 {
+		e.writeByte(EttList)
+		e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(fields))))
+	}
+
+	for _, field := range fields {
+		e.writeTupleHeader(2)
+		if err := e.writeAtom(field.name); err != nil {
+			return err
+		}
+
+		if err := e.writeField(field); err != nil {
+			return err
+		}
+	}
+
+	e.writeByte(EttNil)
+	return nil
+}
+
+// writeProplist writes p as a list of {Key, Value} tuples.
+func (e *Encoder) writeProplist(p Proplist) error {
+	if len(p) > 0 {
+		e.writeByte(EttList)
+		e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(p))))
+	}
+
+	for _, prop := range p {
+		e.writeTupleHeader(2)
+		if err := e.writeAtom(string(prop.Key)); err != nil {
+			return err
+		}
+
+		if err := e.writeTerms([]Term{prop.Value}); err != nil {
+			return err
+		}
+	}
+
+	e.writeByte(EttNil)
+	return nil
+}
+
+// writeTupleHeader writes the tag and arity of a tuple, using SMALL_TUPLE_EXT when it fits.
+func (e *Encoder) writeTupleHeader(arity int) {
+	if arity <= math.MaxUint8 {
+		e.writeByte(EttSmallTuple, byte(arity))
+		return
+	}
+
+	e.writeByte(EttLargeTuple)
+	e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(arity)))
+}
+
+// writeField writes the value of a struct field, as the wire type of its tag when there is one.
+func (e *Encoder) writeField(f structField) error {
+	if f.wire == "" {
+		return e.parseType(f.value)
+	}
+
+	v := f.value
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			e.writeNil()
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	var text string
+	switch {
+	case v.Kind() == reflect.String:
+		text = v.String()
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		text = string(v.Bytes())
+	default:
+		return fmt.Errorf("encode error: field %s of type %s can't be encoded as %s", f.name, v.Type(), f.wire)
+	}
+
+	switch f.wire {
+	case wireAtom:
+		return e.writeAtom(text)
+	case wireCharlist:
+		return e.writeCharlist(text)
+	default:
+		return e.writeBinary([]byte(text))
+	}
+}
+
+// writeTextMarshaler writes the text returned by m as a binary, or as a charlist
+// when the encoder is configured with TextAsCharlist.
+func (e *Encoder) writeTextMarshaler(m encoding.TextMarshaler) error {
+	text, err := m.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	if e.config.TextAsCharlist {
+		return e.writeCharlist(string(text))
+	}
+	return e.writeBinary(text)
+}
+
+// writeBinary writes data as BINARY_EXT.
+func (e *Encoder) writeBinary(data []byte) error {
+	e.writeByte(EttBinary)
+	e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(data))), data)
+	return nil
+}
+
+// writeCharlist writes the code points of s as STRING_EXT when all of them fit in a byte,
+// or as a LIST_EXT of integers otherwise.
+func (e *Encoder) writeCharlist(s string) error {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		e.writeByte(EttNil)
+		return nil
+	}
+
+	latin1 := len(runes) <= math.MaxUint16
+	for _, r := range runes {
+		if r > math.MaxUint8 {
+			latin1 = false
+			break
+		}
+	}
+
+	if latin1 {
+		e.writeByte(EttString)
+		e.writeBytes(binary.BigEndian.AppendUint16([]byte{}, uint16(len(runes))))
+		for _, r := range runes {
+			e.writeByte(byte(r))
+		}
+		return nil
+	}
+
+	e.writeByte(EttList)
+	e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(runes))))
+	for _, r := range runes {
+		e.writeInteger(int64(r))
+	}
+	e.writeByte(EttNil)
+	return nil
+}
+
+// writeBitString writes bs as BIT_BINARY_EXT, clearing the unused bits of its last byte.
+func (e *Encoder) writeBitString(bs BitString) error {
+	bits := bs.Bits
+	if bits == 0 {
+		bits = 8
+	}
+
+	if bits > 8 {
+		return fmt.Errorf("encode error: bitstring uses %d bits of its last byte", bits)
+	}
+
+	data := bytes.Clone(bs.Bytes)
+	if len(data) > 0 {
+		data[len(data)-1] &= 0xFF << (8 - bits)
+	}
+
+	e.writeByte(EttBitBinary)
+	e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(data))))
+	e.writeByte(bits)
+	e.writeBytes(data)
+	return nil
+}
+
 func (e *Encoder) writeBytes(slices ...[]byte) (n int, err error) {
 	c := 0
 	for _, s := range slices {
@@ -347,7 +765,8 @@ func (e *Encoder) writeNil() {
 	e.writeBytes([]byte{119, 3, 110, 105, 108})
 }
 
-func (e *Encoder) writeLargeBig(src reflect.Value) error {
+// writeBig writes a big.Int as SMALL_BIG_EXT when its digits fit in 255 bytes, or as LARGE_BIG_EXT otherwise.
+func (e *Encoder) writeBig(src reflect.Value) error {
 	num, ok := src.Interface().(big.Int)
 	if !ok {
 		return fmt.Errorf("encode error: invalid big int number")
@@ -355,8 +774,12 @@ func (e *Encoder) writeLargeBig(src reflect.Value) error {
 	bigNum := &num
 	b := bigNum.Bytes()
 
-	e.writeByte(EttLargeBig)
-	e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(b))))
+	if len(b) <= math.MaxUint8 {
+		e.writeByte(EttSmallBig, byte(len(b)))
+	} else {
+		e.writeByte(EttLargeBig)
+		e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(b))))
+	}
 
 	sign := bigNum.Sign()
 	if sign < 0 {
@@ -370,6 +793,267 @@ func (e *Encoder) writeLargeBig(src reflect.Value) error {
 	return nil
 }
 
+// writeFloat writes f as FLOAT_EXT, a "%.20e" formatted text padded with NUL bytes.
+func (e *Encoder) writeFloat(f float64) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Errorf("encode error: float %v can't be encoded", f)
+	}
+
+	data := make([]byte, SizeFloat)
+	copy(data, fmt.Sprintf("%.20e", f))
+
+	e.writeByte(EttFloat)
+	e.writeBytes(data)
+	return nil
+}
+
+// writeAtom writes name as SMALL_ATOM_UTF8_EXT or, when it's too long, as ATOM_UTF8_EXT.
+func (e *Encoder) writeAtom(name string) error {
+	data := []byte(name)
+	switch {
+	case len(data) <= math.MaxUint8:
+		e.writeByte(EttSmallAtomUTF8, byte(len(data)))
+	case len(data) <= math.MaxUint16:
+		e.writeByte(EttAtomUTF8)
+		e.writeBytes(binary.BigEndian.AppendUint16([]byte{}, uint16(len(data))))
+	default:
+		return fmt.Errorf("encode error: atom too long")
+	}
+
+	e.writeBytes(data)
+	return nil
+}
+
+// writePid writes p as NEW_PID_EXT, the only pid format accepted since OTP 23.
+func (e *Encoder) writePid(p Pid) error {
+	if p.ID > math.MaxUint32 {
+		return fmt.Errorf("encode error: pid id out of range")
+	}
+
+	e.writeByte(EttNewPid)
+	if err := e.writeAtom(string(p.Node)); err != nil {
+		return err
+	}
+
+	data := binary.BigEndian.AppendUint32([]byte{}, uint32(p.ID))
+	data = binary.BigEndian.AppendUint32(data, p.Serial)
+	data = binary.BigEndian.AppendUint32(data, p.Creation)
+	e.writeBytes(data)
+	return nil
+}
+
+// writePort writes p using the smallest port format that holds its id and creation.
+func (e *Encoder) writePort(p Port) error {
+	var tag ExternalTagType
+	switch {
+	case p.ID <= math.MaxUint32 && p.Creation <= math.MaxUint8:
+		tag = EttPort
+	case p.ID <= math.MaxUint32:
+		tag = EttNewPort
+	default:
+		tag = EttV4Port
+	}
+
+	e.writeByte(tag)
+	if err := e.writeAtom(string(p.Node)); err != nil {
+		return err
+	}
+
+	var data []byte
+	if tag == EttV4Port {
+		data = binary.BigEndian.AppendUint64(data, p.ID)
+	} else {
+		data = binary.BigEndian.AppendUint32(data, uint32(p.ID))
+	}
+
+	if tag == EttPort {
+		data = append(data, byte(p.Creation))
+	} else {
+		data = binary.BigEndian.AppendUint32(data, p.Creation)
+	}
+
+	e.writeBytes(data)
+	return nil
+}
+
+// writeRef writes r as NEWER_REFERENCE_EXT, whatever form it was decoded from.
+func (e *Encoder) writeRef(r Ref) error {
+	length := int(r.Len)
+	if length == 0 {
+		length = 3
+	}
+
+	if length > len(r.ID) {
+		return fmt.Errorf("encode error: reference length out of range")
+	}
+
+	e.writeByte(EttNewerReference)
+	e.writeBytes(binary.BigEndian.AppendUint16([]byte{}, uint16(length)))
+	if err := e.writeAtom(string(r.Node)); err != nil {
+		return err
+	}
+
+	data := binary.BigEndian.AppendUint32([]byte{}, r.Creation)
+	for _, id := range r.ID[:length] {
+		data = binary.BigEndian.AppendUint32(data, id)
+	}
+
+	e.writeBytes(data)
+	return nil
+}
+
+// writeFunction writes f as NEW_FUN_EXT or, when it has no Unique, as the legacy FUN_EXT.
+func (e *Encoder) writeFunction(f Function) error {
+	if f.Unique == [16]byte{} {
+		e.writeByte(EttFun)
+		e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(f.FreeVars))))
+		if err := e.writePid(f.Pid); err != nil {
+			return err
+		}
+
+		if err := e.writeAtom(string(f.Module)); err != nil {
+			return err
+		}
+
+		e.writeInteger(int64(f.OldIndex))
+		e.writeInteger(int64(f.OldUnique))
+		return e.writeTerms(f.FreeVars)
+	}
+
+	// NEW_FUN_EXT starts with its own size, so the body is encoded apart.
+	buf := bytes.NewBuffer(make([]byte, 0))
+	body := &Encoder{config: e.config, w: buf}
+	body.init()
+
+	body.writeByte(f.Arity)
+	body.writeBytes(f.Unique[:])
+	body.writeBytes(binary.BigEndian.AppendUint32([]byte{}, f.Index))
+	body.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(f.FreeVars))))
+	if err := body.writeAtom(string(f.Module)); err != nil {
+		return err
+	}
+
+	body.writeInteger(int64(f.OldIndex))
+	body.writeInteger(int64(f.OldUnique))
+	if err := body.writePid(f.Pid); err != nil {
+		return err
+	}
+
+	if err := body.writeTerms(f.FreeVars); err != nil {
+		return err
+	}
+
+	data, err := body.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	e.writeByte(EttNewFun)
+	e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(SizeNewFunSize+len(data))), data)
+	return nil
+}
+
+// writeExport writes x as EXPORT_EXT.
+func (e *Encoder) writeExport(x Export) error {
+	if x.Arity < 0 || x.Arity > math.MaxUint8 {
+		return fmt.Errorf("encode error: export arity out of range")
+	}
+
+	e.writeByte(EttExport)
+	if err := e.writeAtom(string(x.Module)); err != nil {
+		return err
+	}
+
+	if err := e.writeAtom(string(x.Function)); err != nil {
+		return err
+	}
+
+	e.writeByte(EttSmallInteger, byte(x.Arity))
+	return nil
+}
+
+// writeList writes the elements of an array or slice as a proper list.
+func (e *Encoder) writeList(src reflect.Value) error {
+	arrLen := src.Len()
+	if arrLen == 0 {
+		e.writeByte(EttNil)
+		return nil
+	}
+
+	e.writeByte(EttList)
+
+	blen := make([]byte, 4)
+	binary.BigEndian.PutUint32(blen, uint32(arrLen))
+	e.writeBytes(blen)
+
+	for i := 0; i < arrLen; i++ {
+		elem := src.Index(i)
+		if elem.IsValid() {
+			if err := e.parseType(derefValueOf(elem)); err != nil {
+				return err
+			}
+
+			if elem.Type().Kind() == reflect.Pointer && elem.IsNil() {
+				e.writeNil()
+			}
+		}
+	}
+
+	e.writeByte(EttNil)
+	return nil
+}
+
+// stringFormat returns how plain Go strings are written.
+func (e *Encoder) stringFormat() StringFormat {
+	if e.config.StringOverAtom {
+		return StringAsCharlist
+	}
+
+	return e.config.StringFormat
+}
+
+// writeImproperList writes l as LIST_EXT, using its last element as the tail.
+func (e *Encoder) writeImproperList(l ListImproper) error {
+	if len(l) < 2 {
+		return fmt.Errorf("encode error: improper list needs at least one element and a tail")
+	}
+
+	e.writeByte(EttList)
+	e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(len(l)-1)))
+	return e.writeTerms(l)
+}
+
+// writeTerms writes every term one after the other, without any header.
+func (e *Encoder) writeTerms(terms []Term) error {
+	for _, term := range terms {
+		if term == nil {
+			e.writeNil()
+			continue
+		}
+
+		if err := e.parseType(valueOf(term)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeInteger writes i using the smallest integer format that holds it.
+func (e *Encoder) writeInteger(i int64) error {
+	switch {
+	case 0 <= i && i <= math.MaxUint8:
+		e.writeByte(EttSmallInteger, byte(i))
+	case math.MinInt32 <= i && i <= math.MaxInt32:
+		e.writeByte(EttInteger)
+		e.writeBytes(binary.BigEndian.AppendUint32([]byte{}, uint32(i)))
+	default:
+		return e.parseType(valueOf(i))
+	}
+
+	return nil
+}
+
 func (e *Encoder) assertIntType(i int64) any {
 	switch {
 	case math.MinInt16 < i && i < math.MaxInt16:
@@ -398,15 +1082,19 @@ func (e *Encoder) assertInterfaceType(v any) any {
 	switch v := v.(type) {
 	case
 		[]uint, []uint8, []uint16, []uint32, []uint64,
-		[]int, []int16, []int32, []int64,
+		[]int, []int8, []int16, []int32, []int64,
 		[]float32, []float64,
 		[]string,
 		[]bool,
 		uint, uint8, uint16, uint32, uint64,
-		int, int16, int32, int64,
+		int, int8, int16, int32, int64,
 		float32, float64,
 		string,
-		bool:
+		bool,
+		Pid, Port, Ref, Function, Export,
+		Atom, Binary, Charlist, Tuple, List,
+		ListImproper, Proplist, BitString,
+		*big.Int, big.Int:
 		return v
 	}
 
@@ -2,10 +2,40 @@ package goetf
 
 type EncoderOpt func(*EncoderConfig)
 
+// StringFormat is the term plain Go strings are encoded as.
+type StringFormat int
+
+const (
+	// StringAsAtom encodes strings as atoms, or as charlists when they can't be atoms
+	// because they are too long or contain spaces.
+	StringAsAtom StringFormat = iota
+	// StringAsBinary encodes strings as binaries.
+	StringAsBinary
+	// StringAsCharlist encodes strings as charlists.
+	StringAsCharlist
+)
+
+// SliceFormat is the term plain Go slices are encoded as.
+type SliceFormat int
+
+const (
+	// SliceAsTuple encodes slices as tuples.
+	SliceAsTuple SliceFormat = iota
+	// SliceAsList encodes slices as proper lists.
+	SliceAsList
+)
+
 // DefaultEncoderConfig creates a new default encoder configuration.
 func DefaultEncoderConfig() *EncoderConfig {
 	return &EncoderConfig{
 		StringOverAtom: false,
+		LegacyFloat:    false,
+		Compression:    0,
+		CompressionMin: 0,
+		TextAsCharlist: false,
+		Deterministic:  false,
+		StringFormat:   StringAsAtom,
+		SliceFormat:    SliceAsTuple,
 	}
 }
 
@@ -13,9 +43,24 @@ func DefaultEncoderConfig() *EncoderConfig {
 type EncoderConfig struct {
 	// Encode data as string over atom type
 	StringOverAtom bool
+	// Encode floats as FLOAT_EXT over NEW_FLOAT_EXT
+	LegacyFloat bool
+	// zlib compression level, from 1 to 9. Zero disables compression
+	Compression int
+	// Minimum size in bytes of a term to be compressed
+	CompressionMin int
+	// Encode the output of encoding.TextMarshaler as a charlist over a binary
+	TextAsCharlist bool
+	// Encode map keys sorted in Erlang term order
+	Deterministic bool
+	// Term plain Go strings are encoded as. Atom and Charlist values keep their own term
+	StringFormat StringFormat
+	// Term plain Go slices are encoded as. Tuple and List values keep their own term
+	SliceFormat SliceFormat
 }
 
 // WithStringOverAtom tells the encoder to always encode strings as ETF String.
+// It takes precedence over WithStringFormat.
 //
 // StringOverAtom default value is false.
 func WithStringOverAtom(b bool) EncoderOpt {
@@ -23,3 +68,75 @@ func WithStringOverAtom(b bool) EncoderOpt {
 		ec.StringOverAtom = b
 	}
 }
+
+// WithLegacyFloat tells the encoder to encode floats as the 31 bytes text of FLOAT_EXT,
+// like term_to_binary/2 does with the {minor_version, 0} option.
+//
+// LegacyFloat default value is false.
+func WithLegacyFloat(b bool) EncoderOpt {
+	return func(ec *EncoderConfig) {
+		ec.LegacyFloat = b
+	}
+}
+
+// WithCompression tells the encoder to compress terms with zlib at the given level,
+// from 1 (best speed) to 9 (best compression), like term_to_binary/2 does with the
+// {compressed, Level} option. A term is only sent compressed when that makes it smaller.
+//
+// Compression default value is 0, which disables compression.
+func WithCompression(level int) EncoderOpt {
+	return func(ec *EncoderConfig) {
+		ec.Compression = level
+	}
+}
+
+// WithCompressionMin tells the encoder to only compress terms whose encoding
+// takes at least size bytes.
+//
+// CompressionMin default value is 0.
+func WithCompressionMin(size int) EncoderOpt {
+	return func(ec *EncoderConfig) {
+		ec.CompressionMin = size
+	}
+}
+
+// WithTextAsCharlist tells the encoder to write the output of encoding.TextMarshaler
+// types as a charlist instead of a binary.
+//
+// TextAsCharlist default value is false.
+func WithTextAsCharlist(b bool) EncoderOpt {
+	return func(ec *EncoderConfig) {
+		ec.TextAsCharlist = b
+	}
+}
+
+// WithDeterministic tells the encoder to write map keys sorted in Erlang term order,
+// like term_to_binary/2 does with the deterministic option, so equal values are always
+// encoded to the same bytes. Struct fields are always written in declaration order.
+//
+// Deterministic default value is false.
+func WithDeterministic(b bool) EncoderOpt {
+	return func(ec *EncoderConfig) {
+		ec.Deterministic = b
+	}
+}
+
+// WithStringFormat tells the encoder which term plain Go strings are encoded as.
+// Atom, Binary and Charlist values are always encoded as their own term.
+//
+// StringFormat default value is StringAsAtom.
+func WithStringFormat(f StringFormat) EncoderOpt {
+	return func(ec *EncoderConfig) {
+		ec.StringFormat = f
+	}
+}
+
+// WithSliceFormat tells the encoder which term plain Go slices are encoded as.
+// Tuple and List values are always encoded as their own term, and []byte as a binary.
+//
+// SliceFormat default value is SliceAsTuple.
+func WithSliceFormat(f SliceFormat) EncoderOpt {
+	return func(ec *EncoderConfig) {
+		ec.SliceFormat = f
+	}
+}
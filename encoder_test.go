@@ -5,6 +5,7 @@ import (
 	"maps"
 	"math"
 	"math/big"
+	"net/netip"
 	"reflect"
 	"slices"
 	"strings"
@@ -54,6 +55,20 @@ func TestEncodeInteger(t *testing.T) {
 			t.Errorf("encode error: want = %v got = %v", want, got)
 		}
 	}
+	{
+		// negative integers keep their sign
+		for _, data := range []any{-1, int8(-1), int16(-1)} {
+			got, err := goetf.Marshal(data)
+			if err != nil {
+				t.Fatal("marshal error:", err)
+			}
+
+			want := []byte{131, 98, 255, 255, 255, 255}
+			if !slices.Equal(want, got) {
+				t.Errorf("encode error: %T want = %v got = %v", data, want, got)
+			}
+		}
+	}
 	{
 		var data int32 = math.MaxInt32
 
@@ -91,11 +106,24 @@ func TestEncodeBig(t *testing.T) {
 			t.Fatal("marshal error:", err)
 		}
 
-		want := []byte{131, 111, 0, 0, 0, 4, 0, 0, 0, 0, 1}
+		want := []byte{131, 110, 4, 0, 0, 0, 0, 1}
 		if !slices.Equal(want, got) {
 			t.Errorf("encode error: want = %v got = %v", want, got)
 		}
+	}
+	{
+		data := new(big.Int).Lsh(big.NewInt(-1), 8*255)
 
+		got, err := goetf.Marshal(data)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		want := append([]byte{131, 111, 0, 0, 1, 0, 1}, make([]byte, 255)...)
+		want = append(want, 1)
+		if !slices.Equal(want, got) {
+			t.Errorf("encode error: want = %v got = %v", want, got)
+		}
 	}
 }
 
@@ -126,6 +154,25 @@ func TestEncodeFloat(t *testing.T) {
 			t.Errorf("encode error: want = %v got = %v", want, got)
 		}
 	}
+	{
+		var data float64 = 3.14
+
+		got, err := goetf.Marshal(data, goetf.WithLegacyFloat(true))
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		want := append([]byte{131, 99}, []byte("3.14000000000000012434e+00")...)
+		want = append(want, 0, 0, 0, 0, 0)
+		if !slices.Equal(want, got) {
+			t.Errorf("encode error: want = %v got = %v", want, got)
+		}
+
+		var out float64
+		if err := goetf.Unmarshal(got, &out); err != nil || out != data {
+			t.Errorf("encode error: want = %v got = %v (%v)", data, out, err)
+		}
+	}
 }
 
 func TestEncodeString(t *testing.T) {
@@ -183,6 +230,21 @@ func TestEncodeString(t *testing.T) {
 	}
 }
 
+func TestEncodeBitString(t *testing.T) {
+	// <<255, 7:4>>, with the unused bits set
+	data := goetf.BitString{Bytes: []byte{255, 0x7F}, Bits: 4}
+
+	got, err := goetf.Marshal(data)
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+
+	want := []byte{131, 77, 0, 0, 0, 2, 4, 255, 0x70}
+	if !slices.Equal(want, got) {
+		t.Errorf("encode error: want = %v got = %v", want, got)
+	}
+}
+
 func TestEncodeBool(t *testing.T) {
 	{
 		data := true
@@ -340,6 +402,39 @@ func TestEncodeStructWithNil(t *testing.T) {
 	}
 }
 
+func TestEncodeCompressed(t *testing.T) {
+	data := strings.Repeat("compress me ", 100)
+	{
+		got, err := goetf.Marshal(data, goetf.WithCompression(6))
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if len(got) < 6 || got[1] != 80 || len(got) >= len(data) {
+			t.Fatalf("encode error: want a compressed term got = %v", got)
+		}
+
+		var out string
+		if err := goetf.Unmarshal(got, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if data != out {
+			t.Errorf("encode error: want = %v got = %v", data, out)
+		}
+	}
+	{
+		got, err := goetf.Marshal(data, goetf.WithCompression(6), goetf.WithCompressionMin(4096))
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if got[1] != 107 {
+			t.Errorf("encode error: want an uncompressed term got = %v", got[:8])
+		}
+	}
+}
+
 func TestEncodeOptions(t *testing.T) {
 	data := map[string]int{"1": 1, "2": 2}
 
@@ -371,3 +466,380 @@ func TestEncodeOptions(t *testing.T) {
 		t.Errorf("encode error: want = %v got = %v", want, data)
 	}
 }
+
+func TestEncodePid(t *testing.T) {
+	data := goetf.Pid{Node: "a@b", ID: 85, Serial: 1, Creation: 1710000000}
+
+	got, err := goetf.Marshal(data)
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+
+	want := []byte{131, 88, 119, 3, 97, 64, 98, 0, 0, 0, 85, 0, 0, 0, 1, 101, 236, 135, 128}
+	if !slices.Equal(want, got) {
+		t.Errorf("encode error: want = %v got = %v", want, got)
+	}
+}
+
+func TestEncodeTextMarshaler(t *testing.T) {
+	addr := netip.MustParseAddr("10.0.0.1")
+	{
+		got, err := goetf.Marshal(addr)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		want := []byte{131, 109, 0, 0, 0, 8, 49, 48, 46, 48, 46, 48, 46, 49}
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+	}
+	{
+		got, err := goetf.Marshal(&addr, goetf.WithTextAsCharlist(true))
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		want := []byte{131, 107, 0, 8, 49, 48, 46, 48, 46, 48, 46, 49}
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+
+		var out netip.Addr
+		if err := goetf.Unmarshal(got, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out != addr {
+			t.Errorf("unmarshal error: want = %v got = %v", addr, out)
+		}
+	}
+	{
+		// the big integer has its own terms even though it's a encoding.TextMarshaler
+		got, err := goetf.Marshal([]any{big.NewInt(1), addr})
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		want := []byte{131, 104, 2, 110, 1, 0, 1, 109, 0, 0, 0, 8, 49, 48, 46, 48, 46, 48, 46, 49}
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+	}
+}
+
+// userID is sent as {user, ID}, with a pointer receiver.
+type userID int32
+
+func (u *userID) MarshalETF() ([]byte, error) {
+	return goetf.Marshal(goetf.Tuple{goetf.Atom("user"), int32(*u)})
+}
+
+func TestEncodePointerMarshaler(t *testing.T) {
+	// {user, 7}
+	user := []byte{104, 2, 119, 4, 117, 115, 101, 114, 98, 0, 0, 0, 7}
+	{
+		got, err := goetf.Marshal(userID(7))
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		want := append([]byte{131}, user...)
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+	}
+	{
+		// neither the struct field nor the map value are addressable
+		type session struct {
+			User  userID            `etf:"user"`
+			Peers map[string]userID `etf:"peers"`
+		}
+
+		got, err := goetf.Marshal(session{User: 7, Peers: map[string]userID{"a": 7}})
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		// #{user => {user, 7}, peers => #{a => {user, 7}}}
+		want := []byte{131, 116, 0, 0, 0, 2, 119, 4, 117, 115, 101, 114}
+		want = append(want, user...)
+		want = append(want, 119, 5, 112, 101, 101, 114, 115, 116, 0, 0, 0, 1, 119, 1, 97)
+		want = append(want, user...)
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+	}
+	{
+		got, err := goetf.Marshal([]any{userID(7)})
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		want := append([]byte{131, 104, 1}, user...)
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+	}
+}
+
+func TestEncodeStructTags(t *testing.T) {
+	type Account struct {
+		Kind   string `etf:"kind,atom"`
+		Name   string `etf:"name,binary"`
+		Note   string `etf:"note,omitempty"`
+		Secret string `etf:"-"`
+		Path   string `etf:"path,charlist"`
+	}
+
+	data := Account{Kind: "user", Name: "Al", Secret: "x", Path: "/a"}
+	got, err := goetf.Marshal(data)
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+
+	want := []byte{131, 116, 0, 0, 0, 3,
+		119, 4, 107, 105, 110, 100, 119, 4, 117, 115, 101, 114,
+		119, 4, 110, 97, 109, 101, 109, 0, 0, 0, 2, 65, 108,
+		119, 4, 112, 97, 116, 104, 107, 0, 2, 47, 97,
+	}
+	if !slices.Equal(want, got) {
+		t.Errorf("marshal error: want = %v got = %v", want, got)
+	}
+
+	var out Account
+	if err := goetf.Unmarshal(got, &out); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+
+	data.Secret = ""
+	if out != data {
+		t.Errorf("unmarshal error: want = %v got = %v", data, out)
+	}
+
+	// kind sent as a binary
+	bad := []byte{131, 116, 0, 0, 0, 1, 119, 4, 107, 105, 110, 100, 109, 0, 0, 0, 4, 117, 115, 101, 114}
+	if err := goetf.Unmarshal(bad, &out); err == nil {
+		t.Errorf("unmarshal error: expected error, got = %v", out)
+	}
+}
+
+func TestEncodeRecord(t *testing.T) {
+	type user struct {
+		_    struct{} `etf:"user,record"`
+		Name string   `etf:"name,binary"`
+		Age  uint8    `etf:"age"`
+	}
+
+	type endpoint struct {
+		_    struct{} `etf:",tuple"`
+		Host string
+		Port int
+	}
+	{
+		data := user{Name: "Al", Age: 37}
+		got, err := goetf.Marshal(data)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		// {user, <<"Al">>, 37}
+		want := []byte{131, 104, 3, 119, 4, 117, 115, 101, 114, 109, 0, 0, 0, 2, 65, 108, 97, 37}
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+
+		var out user
+		if err := goetf.Unmarshal(got, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if out != data {
+			t.Errorf("unmarshal error: want = %v got = %v", data, out)
+		}
+	}
+	{
+		data := []endpoint{{Host: "localhost", Port: 4369}}
+		got, err := goetf.Marshal(data)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		// {{localhost, 4369}}
+		want := []byte{131, 104, 1, 104, 2, 119, 9, 108, 111, 99, 97, 108, 104, 111, 115, 116, 98, 0, 0, 17, 17}
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+
+		out := []endpoint{}
+		if err := goetf.Unmarshal(got, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		if !slices.Equal(out, data) {
+			t.Errorf("unmarshal error: want = %v got = %v", data, out)
+		}
+	}
+	{
+		// {admin, <<"Al">>, 37} and {user, <<"Al">>}
+		for _, bad := range [][]byte{
+			{131, 104, 3, 119, 5, 97, 100, 109, 105, 110, 109, 0, 0, 0, 2, 65, 108, 97, 37},
+			{131, 104, 2, 119, 4, 117, 115, 101, 114, 109, 0, 0, 0, 2, 65, 108},
+		} {
+			var out user
+			if err := goetf.Unmarshal(bad, &out); err == nil {
+				t.Errorf("unmarshal error: expected error, got = %v", out)
+			}
+		}
+	}
+}
+
+func TestEncodeProplist(t *testing.T) {
+	type options struct {
+		_       struct{} `etf:",proplist"`
+		Timeout int      `etf:"timeout"`
+		Verbose bool     `etf:"verbose"`
+		Name    string   `etf:"name,binary,omitempty"`
+	}
+	{
+		got, err := goetf.Marshal(options{Timeout: 5000, Verbose: true})
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		// [{timeout, 5000}, {verbose, true}]
+		want := []byte{131, 108, 0, 0, 0, 2,
+			104, 2, 119, 7, 116, 105, 109, 101, 111, 117, 116, 98, 0, 0, 19, 136,
+			104, 2, 119, 7, 118, 101, 114, 98, 111, 115, 101, 119, 4, 116, 114, 117, 101,
+			106,
+		}
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+	}
+	{
+		data := goetf.Proplist{{Key: "debug", Value: true}, {Key: "level", Value: 2}}
+		got, err := goetf.Marshal(data)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		// [{debug, true}, {level, 2}]
+		want := []byte{131, 108, 0, 0, 0, 2,
+			104, 2, 119, 5, 100, 101, 98, 117, 103, 119, 4, 116, 114, 117, 101,
+			104, 2, 119, 5, 108, 101, 118, 101, 108, 98, 0, 0, 0, 2,
+			106,
+		}
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+	}
+}
+
+func TestEncodeDeterministic(t *testing.T) {
+	data := map[any]int{"b": 1, "a": 2, 3: 3, 1.5: 4, true: 5}
+
+	// #{1.5 => 4, 3 => 3, a => 2, b => 1, true => 5}
+	want := []byte{131, 116, 0, 0, 0, 5,
+		70, 63, 248, 0, 0, 0, 0, 0, 0, 98, 0, 0, 0, 4,
+		98, 0, 0, 0, 3, 98, 0, 0, 0, 3,
+		119, 1, 97, 98, 0, 0, 0, 2,
+		119, 1, 98, 98, 0, 0, 0, 1,
+		119, 4, 116, 114, 117, 101, 98, 0, 0, 0, 5,
+	}
+
+	for range 10 {
+		got, err := goetf.Marshal(data, goetf.WithDeterministic(true))
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if !slices.Equal(want, got) {
+			t.Fatalf("marshal error: want = %v got = %v", want, got)
+		}
+	}
+
+	// -1 comes first in term order, though its INTEGER_EXT bytes sort after the ones of 5
+	got, err := goetf.Marshal(map[int32]int32{5: 0, -1: 0}, goetf.WithDeterministic(true))
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+
+	want = []byte{131, 116, 0, 0, 0, 2,
+		98, 255, 255, 255, 255, 98, 0, 0, 0, 0,
+		98, 0, 0, 0, 5, 98, 0, 0, 0, 0,
+	}
+	if !slices.Equal(want, got) {
+		t.Errorf("marshal error: want = %v got = %v", want, got)
+	}
+
+	// plain ints too, with negative keys before positive ones
+	got, err = goetf.Marshal(map[int]uint8{3: 0, 0: 0, -2: 0, -300: 0}, goetf.WithDeterministic(true))
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+
+	// #{-300 => 0, -2 => 0, 0 => 0, 3 => 0}
+	want = []byte{131, 116, 0, 0, 0, 4,
+		98, 255, 255, 254, 212, 97, 0,
+		98, 255, 255, 255, 254, 97, 0,
+		98, 0, 0, 0, 0, 97, 0,
+		98, 0, 0, 0, 3, 97, 0,
+	}
+	if !slices.Equal(want, got) {
+		t.Errorf("marshal error: want = %v got = %v", want, got)
+	}
+}
+
+func TestEncodeInterface(t *testing.T) {
+	type point struct {
+		X int32 `etf:"x"`
+	}
+
+	// {#{a => 1}, #{x => 2}}
+	want := []byte{131, 104, 2,
+		116, 0, 0, 0, 1, 119, 1, 97, 97, 1,
+		116, 0, 0, 0, 1, 119, 1, 120, 98, 0, 0, 0, 2,
+	}
+
+	got, err := goetf.Marshal([]any{map[string]uint8{"a": 1}, point{X: 2}})
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+
+	if !slices.Equal(want, got) {
+		t.Errorf("marshal error: want = %v got = %v", want, got)
+	}
+}
+
+func TestEncodeFormats(t *testing.T) {
+	cases := []struct {
+		in   any
+		opts []goetf.EncoderOpt
+		want []byte
+	}{
+		{"hi", []goetf.EncoderOpt{goetf.WithStringFormat(goetf.StringAsBinary)}, []byte{131, 109, 0, 0, 0, 2, 104, 105}},
+		{"hi", []goetf.EncoderOpt{goetf.WithStringFormat(goetf.StringAsCharlist)}, []byte{131, 107, 0, 2, 104, 105}},
+		{goetf.Atom("a b"), nil, []byte{131, 119, 3, 97, 32, 98}},
+		{goetf.Charlist("hi"), nil, []byte{131, 107, 0, 2, 104, 105}},
+		{goetf.Binary("hi"), nil, []byte{131, 109, 0, 0, 0, 2, 104, 105}},
+		{[]int{1}, []goetf.EncoderOpt{goetf.WithSliceFormat(goetf.SliceAsList)}, []byte{131, 108, 0, 0, 0, 1, 98, 0, 0, 0, 1, 106}},
+		{goetf.Tuple{1}, []goetf.EncoderOpt{goetf.WithSliceFormat(goetf.SliceAsList)}, []byte{131, 104, 1, 98, 0, 0, 0, 1}},
+		{goetf.List{}, nil, []byte{131, 106}},
+		// struct keys stay atoms whatever the string format
+		{struct {
+			A uint8 `etf:"a"`
+		}{1}, []goetf.EncoderOpt{goetf.WithStringFormat(goetf.StringAsBinary)}, []byte{131, 116, 0, 0, 0, 1, 119, 1, 97, 97, 1}},
+	}
+
+	for _, c := range cases {
+		got, err := goetf.Marshal(c.in, c.opts...)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		if !slices.Equal(c.want, got) {
+			t.Errorf("marshal error: %v want = %v got = %v", c.in, c.want, got)
+		}
+	}
+}
@@ -18,5 +18,42 @@ var (
 	errMalformedMap           = fmt.Errorf("malformed ETF. EttMap")
 	errMalformedBinary        = fmt.Errorf("malformed ETF. EttBinary")
 	errMalformedBitBinary     = fmt.Errorf("malformed ETF. EttBitBinary")
+	errMalformedPid           = fmt.Errorf("malformed ETF. EttPid")
+	errMalformedNewPid        = fmt.Errorf("malformed ETF. EttNewPid")
+	errMalformedPort          = fmt.Errorf("malformed ETF. EttPort")
+	errMalformedNewPort       = fmt.Errorf("malformed ETF. EttNewPort")
+	errMalformedV4Port        = fmt.Errorf("malformed ETF. EttV4Port")
+	errMalformedRef           = fmt.Errorf("malformed ETF. EttRef")
+	errMalformedNewRef        = fmt.Errorf("malformed ETF. EttNewReference")
+	errMalformedNewerRef      = fmt.Errorf("malformed ETF. EttNewerReference")
+	errMalformedNewFun        = fmt.Errorf("malformed ETF. EttNewFun")
+	errMalformedFun           = fmt.Errorf("malformed ETF. EttFun")
+	errMalformedExport        = fmt.Errorf("malformed ETF. EttExport")
+	errMalformedCompressed    = fmt.Errorf("malformed ETF. EttCompressed")
 	errMalformed              = fmt.Errorf("malformed ETF")
 )
+
+// ErrFunRejected is returned when decoding a fun with RejectFuns set.
+var ErrFunRejected = fmt.Errorf("decode error: funs are rejected")
+
+// A LimitError is returned when a decoded term goes over a limit of the DecoderConfig.
+// It's returned before the memory for the part over the limit is allocated.
+type LimitError struct {
+	// Name of the DecoderConfig field of the limit
+	Limit string
+	// Value of the limit
+	Max int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("decode error: term exceeds the %s of %d", e.Limit, e.Max)
+}
+
+// An AtomError is returned when a decoded atom isn't in the AllowedAtoms of the DecoderConfig.
+type AtomError struct {
+	Atom Atom
+}
+
+func (e *AtomError) Error() string {
+	return fmt.Sprintf("decode error: atom %q is not allowed", string(e.Atom))
+}
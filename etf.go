@@ -18,6 +18,8 @@ type ExternalTagType = byte
 const (
 	EttAtomCacheRef ExternalTagType = 82
 
+	EttCompressed ExternalTagType = 80 // zlib compressed term, only right after the version number
+
 	EttAtomUTF8      ExternalTagType = (118)
 	EttSmallAtomUTF8 ExternalTagType = (119)
 
@@ -75,13 +77,13 @@ type Term = any
 // A tuple is a compound data type with a fixed number of terms.
 //
 // Ref: https://www.erlang.org/doc/system/data_types.html#tuple
-type Tuple = []Term
+type Tuple []Term
 
 // List type.
 // A list is a compound data type with a variable number of terms.
 //
 // Ref: https://www.erlang.org/doc/system/data_types.html#list
-type List = []Term
+type List []Term
 
 // Map type.
 // A map is a compound data type with a variable number of key-value associations.
@@ -92,27 +94,86 @@ type Map = map[Term]Term
 // Alias type.
 type Alias = Ref
 
-// ListImproper as a workaround for the Erlang's improper list [a|b].
-// Intended to be used to interact with Erlang.
-type ListImproper = []Term
+// ListImproper type.
+// An improper list is a list whose tail is not the empty list, like [a|b].
+// The last element of a ListImproper is the tail, so [a, b|c] is ListImproper{a, b, c}.
+//
+// Ref: https://www.erlang.org/doc/system/data_types.html#list
+type ListImproper []Term
+
+// Proplist type.
+// A proplist is a list of {Key, Value} tuples, like Erlang property lists and Elixir
+// keyword lists. A bare atom in the list is a shorthand for {Atom, true}.
+// Properties keep their order, duplicated keys included.
+//
+// Ref: https://www.erlang.org/doc/apps/stdlib/proplists.html
+type Proplist []Property
+
+// Property is an element of a Proplist.
+type Property struct {
+	Key   Atom
+	Value Term
+}
+
+// Get returns the value of the first property with the given key, like proplists:get_value/2.
+func (p Proplist) Get(key Atom) (Term, bool) {
+	for _, prop := range p {
+		if prop.Key == key {
+			return prop.Value, true
+		}
+	}
+
+	return nil, false
+}
 
 // Atom type.
 // An atom is a literal, a constant with name.
 //
 // Ref: https://www.erlang.org/doc/system/data_types.html#atom
-type Atom = string
+type Atom string
+
+// Binary type.
+// A binary is a bit string whose length is a multiple of eight, like <<"etf">>.
+//
+// Ref: https://www.erlang.org/doc/system/data_types.html#bit-strings-and-binaries
+type Binary []byte
 
 // BitString type.
-// A bit string value encodes as a binary (Erlang type: <<...>>)
+// A bit string whose length doesn't need to be a multiple of eight, like <<1:3>>.
+// Bits is the number of bits used in the last byte, from 1 to 8, counting from
+// the most significant one. A zero Bits is treated as 8 when encoding.
 //
 // Ref: https://www.erlang.org/doc/system/data_types.html#bit-strings-and-binaries
-type BitString = string
+type BitString struct {
+	Bytes []byte
+	Bits  byte
+}
 
-// String type.
-// Strings are a shorthan for a character list (Erlang type: [$e, $t, $f]).
+// BitLen returns the length of the bit string in bits.
+func (bs BitString) BitLen() int {
+	if len(bs.Bytes) == 0 {
+		return 0
+	}
+
+	bits := int(bs.Bits)
+	if bits == 0 {
+		bits = 8
+	}
+
+	return (len(bs.Bytes)-1)*8 + bits
+}
+
+// Charlist type.
+// A charlist is a list of code points, like "etf" which is the list [$e, $t, $f].
+// It holds the text as UTF-8.
 //
 // Ref: https://www.erlang.org/doc/system/data_types.html#string
-type String = string
+type Charlist string
+
+// String type.
+//
+// Deprecated: use Charlist.
+type String = Charlist
 
 // Pid type.
 //
@@ -141,17 +202,25 @@ func (p Pid) String() string {
 // Ref: https://www.erlang.org/doc/system/data_types.html#port-identifier
 type Port struct {
 	Node     Atom
-	ID       uint32
+	ID       uint64
 	Creation uint32
 }
 
 // Ref type.
 //
+// Len is the number of words used from ID. When encoding, a zero Len is
+// treated as 3, the length of references created by erlang:make_ref/0.
+//
+// A Ref is always encoded as NEWER_REFERENCE_EXT, so only those re-encode byte for byte:
+// one decoded from REFERENCE_EXT or NEW_REFERENCE_EXT keeps its words and creation,
+// but is written in the newer form.
+//
 // Link: https://www.erlang.org/doc/system/data_types.html#reference
 type Ref struct {
 	Node     Atom
 	Creation uint32
 	ID       [5]uint32
+	Len      uint16
 }
 
 func (r Ref) String() string {
@@ -164,6 +233,9 @@ func (r Ref) String() string {
 
 // Function type.
 //
+// A Function with a zero Unique comes from, and is encoded as, the legacy FUN_EXT,
+// which only carries OldIndex and OldUnique.
+//
 // Ref: https://www.erlang.org/doc/system/data_types.html#fun
 type Function struct {
 	Arity  byte
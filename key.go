@@ -0,0 +1,253 @@
+package goetf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+)
+
+// Key is a comparable form of a map key that can't be a Go map key, like a binary,
+// a tuple, a list or a map. Decoding a map into an interface uses it for such keys,
+// and the encoder writes it back as the term it was made from.
+//
+// A Key holds its term in a canonical encoding, so equal terms have the same Key
+// whatever Go types hold them: NewKey(Tuple{Atom("node"), 1}) is the key decoded from {node, 1}.
+type Key struct {
+	term string
+}
+
+// NewKey returns the Key of t.
+func NewKey(t Term) (Key, error) {
+	d, elems, err := readElementsOf(DefaultEncoderConfig(), []reflect.Value{valueOf(t)})
+	if err != nil {
+		return Key{}, err
+	}
+
+	return d.keyOf(elems[0]), nil
+}
+
+// Term returns the term of k, decoded as into an interface.
+func (k Key) Term() Term {
+	var t Term
+	if err := Unmarshal(append([]byte{Version}, k.term...), &t); err != nil {
+		return nil
+	}
+
+	return t
+}
+
+func (k Key) String() string {
+	return fmt.Sprint(k.Term())
+}
+
+// Lookup returns the value of key in m. A key that can't be a Go map key,
+// like a Tuple, is looked up by its Key, and an integer key by its value
+// whatever its Go type.
+func Lookup(m Map, key Term) (Term, bool) {
+	key = integerKey(key)
+	if key == nil || reflect.ValueOf(key).Comparable() {
+		v, ok := m[key]
+		return v, ok
+	}
+
+	k, err := NewKey(key)
+	if err != nil {
+		return nil, false
+	}
+
+	v, ok := m[k]
+	return v, ok
+}
+
+// Store sets the value of key in m. A key that can't be a Go map key,
+// like a Tuple, is stored by its Key, and an integer key in the form
+// decoded keys take.
+func Store(m Map, key, value Term) error {
+	key = integerKey(key)
+	if key == nil || reflect.ValueOf(key).Comparable() {
+		m[key] = value
+		return nil
+	}
+
+	k, err := NewKey(key)
+	if err != nil {
+		return err
+	}
+
+	m[k] = value
+	return nil
+}
+
+// integerKey returns an integer key in the form decoded map keys take, whatever its
+// Go type: uint8 or int32 like SMALL_INTEGER_EXT and INTEGER_EXT, or a Key when it needs
+// a big integer. Other keys are returned as they are.
+func integerKey(key Term) Term {
+	var i *big.Int
+	switch k := key.(type) {
+	case *big.Int:
+		if k == nil {
+			return key
+		}
+		i = k
+	case big.Int:
+		i = &k
+	default:
+		v := reflect.ValueOf(key)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i = big.NewInt(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			i = new(big.Int).SetUint64(v.Uint())
+		default:
+			return key
+		}
+	}
+
+	switch {
+	case i.IsUint64() && i.Uint64() <= math.MaxUint8:
+		return uint8(i.Uint64())
+	case i.IsInt64() && math.MinInt32 <= i.Int64() && i.Int64() <= math.MaxInt32:
+		return int32(i.Int64())
+	}
+
+	return Key{term: string(appendKeyInteger(nil, i))}
+}
+
+// keyOf returns the Key of the term held by elem.
+func (d *Decoder) keyOf(elem *binaryElement) Key {
+	return Key{term: string(d.appendKey(nil, elem))}
+}
+
+// appendKey appends the canonical encoding of elem to b: integers in their smallest
+// form, floats as NEW_FLOAT_EXT, atoms as UTF-8, strings as lists of integers,
+// map pairs sorted by key, and identifiers in their newest form.
+func (d *Decoder) appendKey(b []byte, elem *binaryElement) []byte {
+	switch classOf(elem) {
+	case classNumber:
+		i, f, isFloat := d.numberOf(elem)
+		if isFloat {
+			b = append(b, EttNewFloat)
+			return binary.BigEndian.AppendUint64(b, math.Float64bits(f))
+		}
+		return appendKeyInteger(b, i)
+
+	case classAtom:
+		name := d.atomText(elem)
+		if len(name) <= math.MaxUint8 {
+			b = append(b, EttSmallAtomUTF8, byte(len(name)))
+		} else {
+			b = append(b, EttAtomUTF8)
+			b = binary.BigEndian.AppendUint16(b, uint16(len(name)))
+		}
+		return append(b, name...)
+
+	case classTuple:
+		if len(elem.items) <= math.MaxUint8 {
+			b = append(b, EttSmallTuple, byte(len(elem.items)))
+		} else {
+			b = append(b, EttLargeTuple)
+			b = binary.BigEndian.AppendUint32(b, uint32(len(elem.items)))
+		}
+		for _, item := range elem.items {
+			b = d.appendKey(b, item)
+		}
+		return b
+
+	case classMap:
+		pairs := d.sortedPairs(elem)
+		b = append(b, EttMap)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(pairs)))
+		for _, pair := range pairs {
+			b = d.appendKey(b, pair[0])
+			b = d.appendKey(b, pair[1])
+		}
+		return b
+
+	case classNil, classList:
+		heads, tail := listView(elem)
+		if len(heads) == 0 {
+			return d.appendKey(b, tail)
+		}
+
+		b = append(b, EttList)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(heads)))
+		for _, head := range heads {
+			b = d.appendKey(b, head)
+		}
+		if tail.tag == EttNil {
+			return append(b, EttNil)
+		}
+		return d.appendKey(b, tail)
+
+	case classBitString:
+		data, bitLen := bitStringOf(elem)
+		if bitLen%8 == 0 {
+			b = append(b, EttBinary)
+			b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+		} else {
+			b = append(b, EttBitBinary)
+			b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+			b = append(b, byte(bitLen%8))
+		}
+		return append(b, data...)
+
+	case classRef, classPort, classPid, classFun:
+		var parsed any
+		switch classOf(elem) {
+		case classRef:
+			parsed = d.parseRef(elem)
+		case classPort:
+			parsed = d.parsePort(elem)
+		case classPid:
+			parsed = d.parsePid(elem)
+		default:
+			if elem.tag == EttExport {
+				parsed = d.parseExport(elem)
+			} else {
+				parsed = d.parseFunction(elem)
+			}
+		}
+
+		buf := bytes.NewBuffer(make([]byte, 0))
+		enc := &Encoder{config: DefaultEncoderConfig(), w: buf}
+		enc.init()
+		if parsed != nil && enc.parseType(valueOf(parsed)) == nil {
+			if data, err := enc.stream.readAll(); err == nil {
+				return append(b, data...)
+			}
+		}
+	}
+
+	return append(b, elem.raw...)
+}
+
+// appendKeyInteger appends i to b in the smallest integer encoding that holds it.
+func appendKeyInteger(b []byte, i *big.Int) []byte {
+	switch {
+	case i.IsUint64() && i.Uint64() <= math.MaxUint8:
+		return append(b, EttSmallInteger, byte(i.Uint64()))
+	case i.IsInt64() && math.MinInt32 <= i.Int64() && i.Int64() <= math.MaxInt32:
+		b = append(b, EttInteger)
+		return binary.BigEndian.AppendUint32(b, uint32(i.Int64()))
+	}
+
+	sign := byte(0)
+	if i.Sign() < 0 {
+		sign = 1
+	}
+
+	digits := new(big.Int).Abs(i).Bytes()
+	slices.Reverse(digits)
+	if len(digits) <= math.MaxUint8 {
+		b = append(b, EttSmallBig, byte(len(digits)), sign)
+	} else {
+		b = append(b, EttLargeBig)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(digits)))
+		b = append(b, sign)
+	}
+	return append(b, digits...)
+}
@@ -0,0 +1,145 @@
+package goetf_test
+
+import (
+	"math/big"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/nicolito128/goetf"
+)
+
+func TestKey(t *testing.T) {
+	// #{{node, 1} => up, [<<"a">>] => 2}
+	b := []byte{131, 116, 0, 0, 0, 2,
+		104, 2, 100, 0, 4, 110, 111, 100, 101, 97, 1, 119, 2, 117, 112,
+		108, 0, 0, 0, 1, 109, 0, 0, 0, 1, 97, 106, 97, 2,
+	}
+
+	var out any
+	if err := goetf.Unmarshal(b, &out); err != nil {
+		t.Fatal("unmarshal error:", err)
+	}
+
+	m, ok := out.(goetf.Map)
+	if !ok {
+		t.Fatalf("unmarshal error: want a Map got = %#v", out)
+	}
+
+	{
+		// the key is hashed the same whatever the Go types of the tuple
+		got, ok := goetf.Lookup(m, goetf.Tuple{goetf.Atom("node"), 1})
+		if !ok || got != goetf.Atom("up") {
+			t.Errorf("lookup error: want = up got = %v", got)
+		}
+
+		got, ok = goetf.Lookup(m, goetf.List{goetf.Binary("a")})
+		if !ok || got != uint8(2) {
+			t.Errorf("lookup error: want = 2 got = %v", got)
+		}
+
+		if _, ok := goetf.Lookup(m, goetf.Tuple{goetf.Atom("node"), 2}); ok {
+			t.Errorf("lookup error: found a missing key")
+		}
+	}
+	{
+		// #{1 => a, 300 => c, 4294967296 => d}
+		b := []byte{131, 116, 0, 0, 0, 3,
+			97, 1, 119, 1, 97,
+			98, 0, 0, 1, 44, 119, 1, 99,
+			110, 5, 0, 0, 0, 0, 0, 1, 119, 1, 100,
+		}
+
+		var out any
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+		m := out.(goetf.Map)
+
+		// integer keys are found by their value whatever their Go type
+		for key, want := range map[any]goetf.Atom{1: "a", int64(300): "c", uint16(300): "c", 1 << 32: "d", big.NewInt(1 << 32): "d"} {
+			got, ok := goetf.Lookup(m, key)
+			if !ok || got != want {
+				t.Errorf("lookup error: %v want = %v got = %v", key, want, got)
+			}
+		}
+
+		if err := goetf.Store(m, 300, goetf.Atom("e")); err != nil {
+			t.Fatal("store error:", err)
+		}
+		if len(m) != 3 {
+			t.Errorf("store error: want = %v keys got = %v", 3, len(m))
+		}
+	}
+	{
+		// #{-1 => a, {a, -1} => b}
+		b := []byte{131, 116, 0, 0, 0, 2,
+			98, 255, 255, 255, 255, 119, 1, 97,
+			104, 2, 119, 1, 97, 98, 255, 255, 255, 255, 119, 1, 98,
+		}
+
+		var out any
+		if err := goetf.Unmarshal(b, &out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+		m := out.(goetf.Map)
+
+		keys := []struct {
+			key  goetf.Term
+			want goetf.Atom
+		}{
+			{-1, "a"},
+			{int16(-1), "a"},
+			{goetf.Tuple{goetf.Atom("a"), -1}, "b"},
+			{goetf.Tuple{goetf.Atom("a"), int8(-1)}, "b"},
+		}
+		for _, k := range keys {
+			got, ok := goetf.Lookup(m, k.key)
+			if !ok || got != k.want {
+				t.Errorf("lookup error: %v want = %v got = %v", k.key, k.want, got)
+			}
+		}
+	}
+	{
+		key, err := goetf.NewKey(goetf.Tuple{goetf.Atom("node"), 1})
+		if err != nil {
+			t.Fatal("key error:", err)
+		}
+
+		want := goetf.Tuple{goetf.Atom("node"), uint8(1)}
+		if !reflect.DeepEqual(want, key.Term()) {
+			t.Errorf("key error: want = %#v got = %#v", want, key.Term())
+		}
+	}
+	{
+		m := goetf.Map{}
+		if err := goetf.Store(m, goetf.Tuple{goetf.Atom("a"), goetf.Binary("b")}, 1); err != nil {
+			t.Fatal("store error:", err)
+		}
+
+		got, err := goetf.Marshal(m)
+		if err != nil {
+			t.Fatal("marshal error:", err)
+		}
+
+		// #{{a, <<"b">>} => 1}
+		want := []byte{131, 116, 0, 0, 0, 1,
+			104, 2, 119, 1, 97, 109, 0, 0, 0, 1, 98,
+			98, 0, 0, 0, 1,
+		}
+		if !slices.Equal(want, got) {
+			t.Errorf("marshal error: want = %v got = %v", want, got)
+		}
+	}
+	{
+		out := map[goetf.Key]any{}
+		if err := goetf.Unmarshal(b, out); err != nil {
+			t.Fatal("unmarshal error:", err)
+		}
+
+		key, _ := goetf.NewKey(goetf.Tuple{goetf.Atom("node"), 1})
+		if out[key] != goetf.Atom("up") {
+			t.Errorf("unmarshal error: want = up got = %v", out)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package goetf
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// elixirStructKey is the map key holding the module of an Elixir struct.
+const elixirStructKey = "__struct__"
+
+// Registry maps Elixir modules to the Go structs declared with them.
+// A decoder configured WithRegistry decodes an Elixir struct into an interface
+// as the Go struct registered for its __struct__ module.
+type Registry struct {
+	mu    sync.RWMutex
+	types map[Atom]reflect.Type
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{types: map[Atom]reflect.Type{}}
+}
+
+// Register adds the struct type of v, or the struct v points to. The struct must declare
+// its Elixir module with a blank field like _ struct{} `etf:"Elixir.MyApp.User,struct"`.
+func (r *Registry) Register(v any) error {
+	if v == nil {
+		return fmt.Errorf("registry error: can't register a nil value")
+	}
+
+	t := derefTypeOf(v)
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("registry error: %s is not a struct", t)
+	}
+
+	layout := structLayoutOf(t)
+	if layout.kind != layoutStruct || layout.name == "" {
+		return fmt.Errorf("registry error: %s doesn't declare an Elixir module", t)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if other, ok := r.types[Atom(layout.name)]; ok && other != t {
+		return fmt.Errorf("registry error: %s is already registered for %s", layout.name, other)
+	}
+	r.types[Atom(layout.name)] = t
+	return nil
+}
+
+// lookup returns the struct type registered for module.
+func (r *Registry) lookup(module Atom) (reflect.Type, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.types[module]
+	return t, ok
+}
@@ -13,6 +13,11 @@ type scanner struct {
 	scanp int
 	// Total bytes consumed.
 	scanned int64
+	// Maximum bytes to consume since base, zero means no limit.
+	max  int
+	base int64
+	// Error of going over max, kept for every following read.
+	err error
 
 	r io.Reader
 }
@@ -26,20 +31,48 @@ var scannerPool = sync.Pool{
 func newScanner(r io.Reader) *scanner {
 	scan := scannerPool.Get().(*scanner)
 	scan.scanned = 0
+	scan.max, scan.base, scan.err = 0, 0, nil
 	scan.r = r
 	scan.buf = make([]byte, 4096)
 	return scan
 }
 
+// reset grows the buffer, keeping what has been read so far in the same positions.
 func (s *scanner) reset(bufinit int) {
 	newLen := bufinit + len(s.buf)*2
-	s.buf = make([]byte, newLen)
-	s.scanp = 0
+	buf := make([]byte, newLen)
+	copy(buf, s.buf[:s.scanp])
+	s.buf = buf
+}
+
+// limit allows up to max more bytes to be consumed. Zero means no limit.
+func (s *scanner) limit(max int) {
+	s.max = max
+	s.base = s.scanned
+	s.err = nil
+}
+
+// allow checks that n more bytes can be consumed without going over the limit.
+func (s *scanner) allow(n int64) error {
+	if s.err == nil && s.max > 0 && s.scanned-s.base+n > int64(s.max) {
+		s.err = &LimitError{Limit: "MaxInputSize", Max: s.max}
+	}
+
+	return s.err
+}
+
+// since returns the bytes read from the position start up to now.
+func (s *scanner) since(start int) []byte {
+	return s.buf[start:s.scanp]
 }
 
 func (s *scanner) readByte() (byte, error) {
 	_, b, err := s.readN(1)
-	return b[0], err
+	if err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
 }
 
 func (s *scanner) readN(n int) (int, []byte, error) {
@@ -47,6 +80,10 @@ func (s *scanner) readN(n int) (int, []byte, error) {
 		return 0, nil, fmt.Errorf("scanner readN error: invalid buffer")
 	}
 
+	if err := s.allow(int64(n)); err != nil {
+		return 0, nil, err
+	}
+
 	if (s.scanp + n) >= len(s.buf) {
 		s.reset(n)
 	}
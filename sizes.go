@@ -16,20 +16,40 @@ const (
 	SizeBitBinaryBits   SizeType = 1
 	SizeSmallAtom       SizeType = 1
 	SizeSmallAtomUTF8   SizeType = 1
+	SizePidCreation     SizeType = 1
+	SizePortCreation    SizeType = 1
+	SizeRefCreation     SizeType = 1
+	SizeNewFunArity     SizeType = 1
 
 	SizeAtom         SizeType = 2
 	SizeAtomUTF8     SizeType = 2
 	SizeStringLength SizeType = 2
+	SizeRefLen       SizeType = 2
 
-	SizeLargeBigN       SizeType = 4
-	SizeInteger         SizeType = 4
-	SizeMapArity        SizeType = 4
-	SizeBinaryLen       SizeType = 4
-	SizeListLength      SizeType = 4
-	SizeLargeTupleArity SizeType = 4
-	SizeBitBinaryLen    SizeType = 4
+	SizeLargeBigN        SizeType = 4
+	SizeInteger          SizeType = 4
+	SizeMapArity         SizeType = 4
+	SizeBinaryLen        SizeType = 4
+	SizeListLength       SizeType = 4
+	SizeLargeTupleArity  SizeType = 4
+	SizeBitBinaryLen     SizeType = 4
+	SizePidID            SizeType = 4
+	SizePidSerial        SizeType = 4
+	SizeNewPidCreation   SizeType = 4
+	SizePortID           SizeType = 4
+	SizeNewPortCreation  SizeType = 4
+	SizeRefID            SizeType = 4
+	SizeNewerRefCreation SizeType = 4
+	SizeNewFunSize       SizeType = 4
+	SizeNewFunIndex      SizeType = 4
+	SizeNewFunNumFree    SizeType = 4
+	SizeFunNumFree       SizeType = 4
+	SizeCompressedSize   SizeType = 4
 
 	SizeNewFloat SizeType = 8
+	SizeV4PortID SizeType = 8
+
+	SizeNewFunUniq SizeType = 16
 
 	SizeFloat SizeType = 31
 )
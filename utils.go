@@ -1,8 +1,11 @@
 package goetf
 
 import (
-	"maps"
+	"encoding"
+	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
 // valueOf ensures that reflect.ValueOf(v) is not used on another reflect.Value.
@@ -40,6 +43,19 @@ func derefValueOf(v any) reflect.Value {
 	return vOf
 }
 
+// indirectValueOf is like derefValueOf, but allocates a new value for every nil pointer that can be set.
+func indirectValueOf(v any) reflect.Value {
+	vOf := valueOf(v)
+	if vOf.IsValid() && vOf.Type().Kind() == reflect.Pointer {
+		if vOf.IsNil() && vOf.CanSet() {
+			vOf.Set(reflect.New(vOf.Type().Elem()))
+		}
+		return indirectValueOf(vOf.Elem())
+	}
+
+	return vOf
+}
+
 // derefTypeOf recursively dereferences all pointers of a type by calling its method v.Elem().
 func derefTypeOf(v any) reflect.Type {
 	vOf := typeOf(v)
@@ -51,6 +67,20 @@ func derefTypeOf(v any) reflect.Type {
 	}
 }
 
+// typeOfKind maps every sized number kind to its Go type.
+var typeOfKind = map[reflect.Kind]reflect.Type{
+	reflect.Int:    reflect.TypeOf(int(0)),
+	reflect.Int8:   reflect.TypeOf(int8(0)),
+	reflect.Int16:  reflect.TypeOf(int16(0)),
+	reflect.Int32:  reflect.TypeOf(int32(0)),
+	reflect.Int64:  reflect.TypeOf(int64(0)),
+	reflect.Uint:   reflect.TypeOf(uint(0)),
+	reflect.Uint8:  reflect.TypeOf(uint8(0)),
+	reflect.Uint16: reflect.TypeOf(uint16(0)),
+	reflect.Uint32: reflect.TypeOf(uint32(0)),
+	reflect.Uint64: reflect.TypeOf(uint64(0)),
+}
+
 // toLittleEndian flips a BigEndian slice.
 func toLittleEndian(b []byte) {
 	for i := 0; i < len(b)/2; i++ {
@@ -58,6 +88,41 @@ func toLittleEndian(b []byte) {
 	}
 }
 
+// latin1ToUTF8 returns the text of b, whose bytes are Latin-1 code points, as UTF-8.
+func latin1ToUTF8(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+
+	return string(runes)
+}
+
+// makeSliceFrom returns a slice of length n with the type of src, reusing its backing array
+// when there is enough capacity. Reused elements are set to their zero value.
+func makeSliceFrom(src reflect.Value, n int) reflect.Value {
+	if src.IsNil() || src.Cap() < n {
+		return reflect.MakeSlice(src.Type(), n, n)
+	}
+
+	s := src.Slice(0, n)
+	for i := 0; i < n; i++ {
+		s.Index(i).SetZero()
+	}
+
+	return s
+}
+
+// convertValueOf converts v to t when they only differ by name, like a string decoded
+// for an Atom or a []byte for a Binary. Other values are returned as they are.
+func convertValueOf(v reflect.Value, t reflect.Type) reflect.Value {
+	if v.Type() != t && v.Kind() == t.Kind() && v.Type().ConvertibleTo(t) {
+		return v.Convert(t)
+	}
+
+	return v
+}
+
 func setValueNotPtr(dist reflect.Type, element reflect.Value, handleSet func(reflect.Value)) {
 	if dist.Kind() == reflect.Pointer {
 		ptr := reflect.New(element.Type())
@@ -68,35 +133,296 @@ func setValueNotPtr(dist reflect.Type, element reflect.Value, handleSet func(ref
 	}
 }
 
-// deepFieldsFrom filters all the public fields from the src struct.
+var (
+	typeOfMarshaler         = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	typeOfUnmarshaler       = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	typeOfTextMarshaler     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	typeOfTextUnmarshaler   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	typeOfBinaryMarshaler   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	typeOfBinaryUnmarshaler = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// marshalerOf returns the iface implemented by v, or by a pointer to v. A v that isn't
+// addressable, like a map value, is copied so the pointer methods can be called.
+func marshalerOf(v reflect.Value, iface reflect.Type) (any, bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, false
+	}
+
+	if v.Type().Implements(iface) {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return nil, false
+		}
+		return v.Interface(), true
+	}
+
+	if v.Kind() != reflect.Pointer && reflect.PointerTo(v.Type()).Implements(iface) {
+		if !v.CanAddr() {
+			addr := reflect.New(v.Type())
+			addr.Elem().Set(v)
+			return addr.Interface(), true
+		}
+		return v.Addr().Interface(), true
+	}
+
+	return nil, false
+}
+
+// implementsMarshaler reports whether t, or a pointer to t, implements Marshaler,
+// encoding.TextMarshaler or encoding.BinaryMarshaler.
+func implementsMarshaler(t reflect.Type) bool {
+	if t.Kind() != reflect.Pointer && implementsMarshaler(reflect.PointerTo(t)) {
+		return true
+	}
+	return t.Implements(typeOfMarshaler) || t.Implements(typeOfTextMarshaler) || t.Implements(typeOfBinaryMarshaler)
+}
+
+// implementsUnmarshaler reports whether t, a pointer to t, or any of the types t points to implements iface.
+func implementsUnmarshaler(t, iface reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		if t.Implements(iface) {
+			return true
+		}
+		t = t.Elem()
+	}
+
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// unmarshalerOf returns the iface implemented by v, or by a pointer to v, and the value it decodes into.
+// Nil pointers on the way are allocated.
+func unmarshalerOf(v reflect.Value, iface reflect.Type) (any, reflect.Value, bool) {
+	for v.CanInterface() {
+		if v.Type().Implements(iface) {
+			if v.Kind() != reflect.Pointer {
+				return v.Interface(), v, true
+			}
+
+			if v.IsNil() {
+				if !v.CanSet() {
+					break
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			return v.Interface(), v.Elem(), true
+		}
+
+		if v.Kind() != reflect.Pointer {
+			if v.CanAddr() && reflect.PointerTo(v.Type()).Implements(iface) {
+				return v.Addr().Interface(), v, true
+			}
+			break
+		}
+
+		if v.IsNil() {
+			if !v.CanSet() {
+				break
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	return nil, v, false
+}
+
+// Wire types a string field can be forced to with a tag option.
+const (
+	wireAtom     = "atom"
+	wireBinary   = "binary"
+	wireCharlist = "charlist"
+)
+
+// structField is a struct field along with the options of its "etf" tag.
+type structField struct {
+	name  string
+	value reflect.Value
+	// omitEmpty skips the field when encoding if it holds an empty value
+	omitEmpty bool
+	// wire is the term a string field is sent as, or empty to use the encoder defaults
+	wire string
+	// required fails the decoding when the key of the field is missing
+	required bool
+	// def is the text of the value set when decoding if the key of the field is missing
+	def        string
+	hasDefault bool
+}
+
+// parseFieldTag splits an "etf" tag like "name,omitempty,binary,default=guest" into
+// a structField with its name and options. A default value can't contain commas.
+func parseFieldTag(tag string) structField {
+	name, opts, _ := strings.Cut(tag, ",")
+	f := structField{name: name}
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+
+		switch opt {
+		case "omitempty":
+			f.omitEmpty = true
+		case "required":
+			f.required = true
+		case wireAtom, wireBinary, wireCharlist:
+			f.wire = opt
+		default:
+			if def, ok := strings.CutPrefix(opt, "default="); ok {
+				f.def, f.hasDefault = def, true
+			}
+		}
+	}
+
+	return f
+}
+
+// deepFieldsFrom filters all the fields from the src struct, in declaration order.
 //
-// This function enters those embedded parameters that do not have the "etf" tag.
-func deepFieldsFrom(src reflect.Value) map[string]reflect.Value {
+// This function enters those embedded parameters that do not have a name in the "etf" tag,
+// and skips the fields tagged with "-".
+func deepFieldsFrom(src reflect.Value) []structField {
 	if src.Type().Kind() != reflect.Struct {
 		panic("error trying to decode a no-struct type")
 	}
 
-	result := map[string]reflect.Value{}
+	result := []structField{}
+	index := map[string]int{}
+	add := func(f structField) {
+		if i, ok := index[f.name]; ok {
+			result[i] = f
+			return
+		}
+		index[f.name] = len(result)
+		result = append(result, f)
+	}
+
 	for i := 0; i < src.NumField(); i++ {
 		fval := src.Field(i)
 		ftyp := src.Type().Field(i)
 		tag := ftyp.Tag.Get("etf")
+		if tag == "-" || ftyp.Name == "_" {
+			continue
+		}
 
-		if ftyp.Anonymous {
-			m := deepFieldsFrom(fval)
-			maps.Copy(result, m)
-		} else {
-			if tag != "" {
-				result[tag] = fval
-			} else {
-				result[ftyp.Name] = fval
+		f := parseFieldTag(tag)
+		if ftyp.Anonymous && f.name == "" {
+			for _, f := range deepFieldsFrom(fval) {
+				add(f)
 			}
+			continue
+		}
+
+		if f.name == "" {
+			f.name = ftyp.Name
 		}
+		f.value = fval
+		add(f)
 	}
 
 	return result
 }
 
+// setDefault sets the field f to the value of its tag default, parsed for the type of the field.
+// Types that implement encoding.TextUnmarshaler parse it themselves.
+func setDefault(f structField) error {
+	field := f.value
+	if field.Kind() == reflect.Pointer {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	if field.CanAddr() {
+		if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(f.def))
+		}
+	}
+
+	var err error
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(f.def)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(f.def)
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(f.def, 10, field.Type().Bits())
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(f.def, 10, field.Type().Bits())
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var fl float64
+		fl, err = strconv.ParseFloat(f.def, field.Type().Bits())
+		field.SetFloat(fl)
+	default:
+		return fmt.Errorf("decode error: field %s of type %s can't have a default", f.name, f.value.Type())
+	}
+
+	if err != nil {
+		return fmt.Errorf("decode error: invalid default %q for field %s: %w", f.def, f.name, err)
+	}
+
+	return nil
+}
+
+// Struct layouts, set with the tag of a blank field.
+const (
+	layoutRecord   = "record"
+	layoutTuple    = "tuple"
+	layoutProplist = "proplist"
+	layoutStruct   = "struct"
+)
+
+// structLayout is how a struct is sent when it's not a map. It's declared with the tag
+// of a blank field, like _ struct{} `etf:"user,record"` for the record {user, Name, Age},
+// _ struct{} `etf:",tuple"` for the positional tuple {Host, Port},
+// _ struct{} `etf:",proplist"` for the proplist [{host, Host}, {port, Port}],
+// or _ struct{} `etf:"Elixir.MyApp.User,struct"` for the Elixir struct %MyApp.User{},
+// a map with a __struct__ key.
+type structLayout struct {
+	kind string
+	// name is the tag atom of a record, or the module of an Elixir struct
+	name string
+}
+
+// structLayoutOf returns the layout declared by the blank fields of the struct type t.
+func structLayoutOf(t reflect.Type) structLayout {
+	var layout structLayout
+	for i := 0; i < t.NumField(); i++ {
+		ftyp := t.Field(i)
+		if ftyp.Name != "_" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(ftyp.Tag.Get("etf"), ",")
+		for opts != "" {
+			var opt string
+			opt, opts, _ = strings.Cut(opts, ",")
+
+			switch opt {
+			case layoutRecord, layoutTuple, layoutProplist, layoutStruct:
+				layout = structLayout{kind: opt, name: name}
+			}
+		}
+	}
+
+	return layout
+}
+
+// isEmptyValue reports whether v is false, 0, a nil pointer or interface,
+// or an empty array, map, slice or string.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+
+	return v.IsZero()
+}
+
 // TagString returns the string representation for an external format tag.
 func TagString(ett ExternalTagType) string {
 	if tag, ok := tagNames[ett]; ok {
@@ -112,32 +438,35 @@ func IsValidEtt(b byte) bool {
 }
 
 var tagNames = map[ExternalTagType]string{
-	EttAtom:          "ATOM_EXT",
-	EttAtomUTF8:      "ATOM_UTF8_EXT",
-	EttBinary:        "BINARY_EXT",
-	EttBitBinary:     "BIT_BINARY_EXT",
-	EttAtomCacheRef:  "ATOM_CACHE_REF",
-	EttExport:        "EXPORT_EXT",
-	EttFloat:         "FLOAT_EXT",
-	EttFun:           "FUN_EXT",
-	EttInteger:       "INTEGER_EXT",
-	EttLargeBig:      "LARGE_BIG_EXT",
-	EttLargeTuple:    "LARGE_TUPLE_EXT",
-	EttList:          "LIST_EXT",
-	EttNewFloat:      "NEW_FLOAT_EXT",
-	EttNewFun:        "NEW_FUN_EXT",
-	EttNewReference:  "NEW_REFERENCE_EXT",
-	EttNil:           "NIL_EXT",
-	EttPid:           "PID_EXT",
-	EttPort:          "PORT_EXT",
-	EttRef:           "REFERENCE_EXT",
-	EttSmallAtom:     "SMALL_ATOM_EXT",
-	EttSmallAtomUTF8: "SMALL_ATOM_UTF8_EXT",
-	EttSmallBig:      "SMALL_BIG_EXT",
-	EttSmallInteger:  "SMALL_INTEGER_EXT",
-	EttSmallTuple:    "SMALL_TUPLE_EXT",
-	EttMap:           "MAP_EXT",
-	EttString:        "STRING_EXT",
-	EttV4Port:        "V4_PORT_EXT",
-	EttLocal:         "LOCAL_EXT",
+	EttAtom:           "ATOM_EXT",
+	EttAtomUTF8:       "ATOM_UTF8_EXT",
+	EttBinary:         "BINARY_EXT",
+	EttBitBinary:      "BIT_BINARY_EXT",
+	EttAtomCacheRef:   "ATOM_CACHE_REF",
+	EttExport:         "EXPORT_EXT",
+	EttFloat:          "FLOAT_EXT",
+	EttFun:            "FUN_EXT",
+	EttInteger:        "INTEGER_EXT",
+	EttLargeBig:       "LARGE_BIG_EXT",
+	EttLargeTuple:     "LARGE_TUPLE_EXT",
+	EttList:           "LIST_EXT",
+	EttNewFloat:       "NEW_FLOAT_EXT",
+	EttNewFun:         "NEW_FUN_EXT",
+	EttNewPid:         "NEW_PID_EXT",
+	EttNewPort:        "NEW_PORT_EXT",
+	EttNewerReference: "NEWER_REFERENCE_EXT",
+	EttNewReference:   "NEW_REFERENCE_EXT",
+	EttNil:            "NIL_EXT",
+	EttPid:            "PID_EXT",
+	EttPort:           "PORT_EXT",
+	EttRef:            "REFERENCE_EXT",
+	EttSmallAtom:      "SMALL_ATOM_EXT",
+	EttSmallAtomUTF8:  "SMALL_ATOM_UTF8_EXT",
+	EttSmallBig:       "SMALL_BIG_EXT",
+	EttSmallInteger:   "SMALL_INTEGER_EXT",
+	EttSmallTuple:     "SMALL_TUPLE_EXT",
+	EttMap:            "MAP_EXT",
+	EttString:         "STRING_EXT",
+	EttV4Port:         "V4_PORT_EXT",
+	EttLocal:          "LOCAL_EXT",
 }
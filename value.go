@@ -0,0 +1,695 @@
+package goetf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Kind is the kind of term held by a Value.
+type Kind int
+
+const (
+	KindInvalid Kind = iota
+	KindInteger
+	KindFloat
+	KindAtom
+	KindBinary
+	KindBitString
+	KindCharlist
+	KindNil
+	KindList
+	KindTuple
+	KindMap
+	KindPid
+	KindPort
+	KindRef
+	KindFun
+)
+
+var kindNames = [...]string{
+	KindInvalid:   "invalid",
+	KindInteger:   "integer",
+	KindFloat:     "float",
+	KindAtom:      "atom",
+	KindBinary:    "binary",
+	KindBitString: "bitstring",
+	KindCharlist:  "charlist",
+	KindNil:       "nil",
+	KindList:      "list",
+	KindTuple:     "tuple",
+	KindMap:       "map",
+	KindPid:       "pid",
+	KindPort:      "port",
+	KindRef:       "reference",
+	KindFun:       "fun",
+}
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return kindNames[KindInvalid]
+	}
+
+	return kindNames[k]
+}
+
+// Value is a read-only view over an encoded term. It doesn't build a tree of the term
+// nor copy its bytes: every method parses just what it needs from the encoded data,
+// so reading a single field of a large term is cheap.
+//
+// A Value refers to the data passed to ParseValue, which must not be modified while in use.
+type Value struct {
+	// b holds the encoded term, starting with its tag
+	b []byte
+}
+
+// ParseValue validates data, a term encoded with its version number like the output
+// of Marshal, and returns a Value over it. A compressed term is inflated first.
+//
+// Of the limits set by opts, ParseValue checks MaxInputSize against data and the inflated
+// term, and MaxDepth; the others are checked when the Value is unmarshalled.
+func ParseValue(data []byte, opts ...DecoderOpt) (Value, error) {
+	config := DefaultDecoderConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if len(data) == 0 || data[0] != Version {
+		return Value{}, errMalformed
+	}
+	data = data[1:]
+
+	if max := config.MaxInputSize; max > 0 && len(data) > max {
+		return Value{}, &LimitError{Limit: "MaxInputSize", Max: max}
+	}
+
+	if len(data) > 0 && data[0] == EttCompressed {
+		inflated, err := inflateTerm(data[1:], config.MaxInputSize)
+		if err != nil {
+			return Value{}, err
+		}
+		data = inflated
+	}
+
+	n, err := skipTermDepth(data, config.MaxDepth)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if n != len(data) {
+		return Value{}, fmt.Errorf("value error: %d bytes after the term", len(data)-n)
+	}
+
+	return Value{b: data}, nil
+}
+
+// maxInflateRatio is the best compression ratio of deflate. A compressed term that
+// claims to inflate beyond it is malformed.
+const maxInflateRatio = 1032
+
+// inflateTerm decompresses the body of a compressed term, made of the uncompressed size and the zlib data.
+// A non-zero max limits the uncompressed size.
+func inflateTerm(data []byte, max int) ([]byte, error) {
+	if len(data) < SizeCompressedSize {
+		return nil, errMalformedCompressed
+	}
+
+	size := binary.BigEndian.Uint32(data)
+	if max > 0 && int64(size) > int64(max) {
+		return nil, &LimitError{Limit: "MaxInputSize", Max: max}
+	}
+
+	if int64(size) > int64(len(data)-SizeCompressedSize)*maxInflateRatio {
+		return nil, errMalformedCompressed
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data[SizeCompressedSize:]))
+	if err != nil {
+		return nil, errMalformedCompressed
+	}
+	defer zr.Close()
+
+	// the declared size can't be trusted, so the buffer only grows with the inflated data
+	var inflated bytes.Buffer
+	if n, err := inflated.ReadFrom(io.LimitReader(zr, int64(size))); err != nil || n != int64(size) {
+		return nil, errMalformedCompressed
+	}
+
+	// the stream must end right at the declared size, which also verifies its checksum
+	if n, err := io.CopyN(io.Discard, zr, 1); n != 0 || err != io.EOF {
+		return nil, errMalformedCompressed
+	}
+
+	return inflated.Bytes(), nil
+}
+
+// Kind returns the kind of the term.
+func (v Value) Kind() Kind {
+	if len(v.b) == 0 {
+		return KindInvalid
+	}
+
+	switch v.b[0] {
+	case EttSmallInteger, EttInteger, EttSmallBig, EttLargeBig:
+		return KindInteger
+	case EttNewFloat, EttFloat:
+		return KindFloat
+	case EttAtom, EttAtomUTF8, EttSmallAtom, EttSmallAtomUTF8:
+		return KindAtom
+	case EttBinary:
+		return KindBinary
+	case EttBitBinary:
+		if v.b[SizeBitBinaryLen+1] == 8 {
+			return KindBinary
+		}
+		return KindBitString
+	case EttString:
+		return KindCharlist
+	case EttNil:
+		return KindNil
+	case EttList:
+		return KindList
+	case EttSmallTuple, EttLargeTuple:
+		return KindTuple
+	case EttMap:
+		return KindMap
+	case EttPid, EttNewPid:
+		return KindPid
+	case EttPort, EttNewPort, EttV4Port:
+		return KindPort
+	case EttRef, EttNewReference, EttNewerReference:
+		return KindRef
+	case EttNewFun, EttFun, EttExport:
+		return KindFun
+	}
+
+	return KindInvalid
+}
+
+// Raw returns the encoded term, starting with its tag and without the version number.
+func (v Value) Raw() []byte {
+	return v.b
+}
+
+// Unmarshal decodes the term into the value pointed to by out, like the Unmarshal function.
+func (v Value) Unmarshal(out any, opts ...DecoderOpt) error {
+	data := make([]byte, 0, len(v.b)+1)
+	data = append(data, Version)
+	data = append(data, v.b...)
+	return Unmarshal(data, out, opts...)
+}
+
+// Int returns the value of an integer term that fits in an int64.
+func (v Value) Int() (int64, error) {
+	if v.Kind() != KindInteger {
+		return 0, v.kindError(KindInteger)
+	}
+
+	switch v.b[0] {
+	case EttSmallInteger:
+		return int64(v.b[1]), nil
+	case EttInteger:
+		return int64(int32(binary.BigEndian.Uint32(v.b[1:]))), nil
+	}
+
+	var n, sign int
+	var digits []byte
+	if v.b[0] == EttSmallBig {
+		n, sign, digits = int(v.b[1]), int(v.b[2]), v.b[3:]
+	} else {
+		n, sign, digits = int(binary.BigEndian.Uint32(v.b[1:])), int(v.b[5]), v.b[6:]
+	}
+
+	// the digits are little endian, so the trailing zeros don't count
+	for n > 0 && digits[n-1] == 0 {
+		n--
+	}
+	if n > 8 {
+		return 0, fmt.Errorf("value error: integer overflows int64")
+	}
+
+	var u uint64
+	for i := n - 1; i >= 0; i-- {
+		u = u<<8 | uint64(digits[i])
+	}
+
+	switch {
+	case sign == 0 && u <= math.MaxInt64:
+		return int64(u), nil
+	case sign != 0 && u <= 1<<63:
+		return int64(-u), nil
+	}
+
+	return 0, fmt.Errorf("value error: integer overflows int64")
+}
+
+// Float returns the value of a float term.
+func (v Value) Float() (float64, error) {
+	switch {
+	case v.Kind() != KindFloat:
+		return 0, v.kindError(KindFloat)
+	case v.b[0] == EttNewFloat:
+		return math.Float64frombits(binary.BigEndian.Uint64(v.b[1:])), nil
+	}
+
+	d := Decoder{}
+	f := d.parseFloat(v.b[1 : 1+SizeFloat])
+	return f, d.err
+}
+
+// AtomString returns the name of an atom term.
+func (v Value) AtomString() (string, error) {
+	name, ok := v.atomName()
+	if !ok {
+		return "", v.kindError(KindAtom)
+	}
+
+	if v.b[0] == EttAtom || v.b[0] == EttSmallAtom {
+		return latin1ToUTF8(name), nil
+	}
+
+	return string(name), nil
+}
+
+// atomName returns the encoded name of an atom term, without copying it.
+func (v Value) atomName() ([]byte, bool) {
+	if len(v.b) == 0 {
+		return nil, false
+	}
+
+	switch v.b[0] {
+	case EttSmallAtom, EttSmallAtomUTF8:
+		return v.b[2 : 2+int(v.b[1])], true
+	case EttAtom, EttAtomUTF8:
+		return v.b[3 : 3+int(binary.BigEndian.Uint16(v.b[1:]))], true
+	}
+
+	return nil, false
+}
+
+// Bytes returns the bytes of a binary term, without copying them.
+func (v Value) Bytes() ([]byte, error) {
+	if v.Kind() != KindBinary {
+		return nil, v.kindError(KindBinary)
+	}
+
+	return v.binaryBytes(), nil
+}
+
+// binaryBytes returns the bytes of a BINARY_EXT or BIT_BINARY_EXT term.
+func (v Value) binaryBytes() []byte {
+	size := int(binary.BigEndian.Uint32(v.b[1:]))
+	if v.b[0] == EttBinary {
+		return v.b[1+SizeBinaryLen : 1+SizeBinaryLen+size]
+	}
+
+	start := 1 + SizeBitBinaryLen + SizeBitBinaryBits
+	return v.b[start : start+size]
+}
+
+// Len returns the number of elements of a tuple, map, list or charlist.
+// The tail of an improper list is not counted.
+func (v Value) Len() int {
+	switch v.Kind() {
+	case KindTuple:
+		n, _ := v.tupleArity()
+		return n
+	case KindMap, KindList:
+		return int(binary.BigEndian.Uint32(v.b[1:]))
+	case KindCharlist:
+		return int(binary.BigEndian.Uint16(v.b[1:]))
+	}
+
+	return 0
+}
+
+// tupleArity returns the arity of a tuple term and the offset of its first element.
+func (v Value) tupleArity() (int, int) {
+	if v.b[0] == EttSmallTuple {
+		return int(v.b[1]), 1 + SizeSmallTupleArity
+	}
+
+	return int(binary.BigEndian.Uint32(v.b[1:])), 1 + SizeLargeTupleArity
+}
+
+// TupleElem returns the element i of a tuple term, counting from zero.
+func (v Value) TupleElem(i int) (Value, error) {
+	if v.Kind() != KindTuple {
+		return Value{}, v.kindError(KindTuple)
+	}
+
+	arity, off := v.tupleArity()
+	if i < 0 || i >= arity {
+		return Value{}, fmt.Errorf("value error: index %d out of a tuple of arity %d", i, arity)
+	}
+
+	for ; i > 0; i-- {
+		n, _ := skipTerm(v.b[off:])
+		off += n
+	}
+
+	n, _ := skipTerm(v.b[off:])
+	return Value{b: v.b[off : off+n]}, nil
+}
+
+// MapGet returns the value of the key of a map term whose atom or binary key is named key.
+func (v Value) MapGet(key string) (Value, bool) {
+	if v.Kind() != KindMap {
+		return Value{}, false
+	}
+
+	pairs := int(binary.BigEndian.Uint32(v.b[1:]))
+	off := 1 + SizeMapArity
+	for i := 0; i < pairs; i++ {
+		n, _ := skipTerm(v.b[off:])
+		k := Value{b: v.b[off : off+n]}
+		off += n
+
+		n, _ = skipTerm(v.b[off:])
+		if k.hasName(key) {
+			return Value{b: v.b[off : off+n]}, true
+		}
+		off += n
+	}
+
+	return Value{}, false
+}
+
+// hasName reports whether v is an atom or a binary named key.
+func (v Value) hasName(key string) bool {
+	if name, ok := v.atomName(); ok {
+		if v.b[0] == EttAtom || v.b[0] == EttSmallAtom {
+			return latin1ToUTF8(name) == key
+		}
+		return string(name) == key
+	}
+
+	if v.Kind() == KindBinary {
+		return string(v.binaryBytes()) == key
+	}
+
+	return false
+}
+
+// ListIter returns an iterator over the elements of a list, charlist or nil term.
+func (v Value) ListIter() ListIter {
+	switch v.Kind() {
+	case KindNil:
+		return ListIter{}
+	case KindList:
+		return ListIter{rest: v.b[1+SizeListLength:], left: v.Len()}
+	case KindCharlist:
+		return ListIter{chars: v.b[1+SizeStringLength:], left: v.Len()}
+	}
+
+	return ListIter{err: v.kindError(KindList)}
+}
+
+func (v Value) kindError(want Kind) error {
+	return fmt.Errorf("value error: %s is not a %s", v.Kind(), want)
+}
+
+// ListIter iterates over the elements of a list term:
+//
+//	it := v.ListIter()
+//	for it.Next() {
+//		elem := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ListIter struct {
+	rest  []byte
+	chars []byte
+	left  int
+	cur   Value
+	err   error
+}
+
+// Next moves the iterator to the next element, and reports whether there is one.
+func (it *ListIter) Next() bool {
+	if it.err != nil || it.left == 0 {
+		return false
+	}
+	it.left--
+
+	if it.chars != nil {
+		it.cur = Value{b: smallIntegers[it.chars[0]][:]}
+		it.chars = it.chars[1:]
+		return true
+	}
+
+	n, _ := skipTerm(it.rest)
+	it.cur = Value{b: it.rest[:n]}
+	it.rest = it.rest[n:]
+	return true
+}
+
+// Value returns the current element.
+func (it *ListIter) Value() Value {
+	return it.cur
+}
+
+// Tail returns the tail of the list once all its elements have been read,
+// which is nil for a proper list.
+func (it *ListIter) Tail() Value {
+	if it.left > 0 || it.rest == nil {
+		return Value{b: nilTerm}
+	}
+
+	return Value{b: it.rest}
+}
+
+// Err returns the error of the iterator, if the term is not a list.
+func (it *ListIter) Err() error {
+	return it.err
+}
+
+// nilTerm is the encoding of the empty list.
+var nilTerm = []byte{EttNil}
+
+// smallIntegers holds the encoding of every SMALL_INTEGER_EXT, the elements of a charlist.
+var smallIntegers = func() (ints [256][2]byte) {
+	for i := range ints {
+		ints[i] = [2]byte{EttSmallInteger, byte(i)}
+	}
+	return ints
+}()
+
+// skipTerm returns the length of the term that starts at b[0].
+func skipTerm(b []byte) (int, error) {
+	return skipTermDepth(b, 0)
+}
+
+// skipTermDepth returns the length of the term that starts at b[0], failing when tuples,
+// lists, maps and funs are nested more than maxDepth levels deep. A zero maxDepth means
+// no limit. It walks nested terms with its own stack, so deep input can't overflow the
+// goroutine stack.
+func skipTermDepth(b []byte, maxDepth int) (int, error) {
+	off := 0
+	// terms left to skip at each open level, the first one being the root; shallow
+	// terms fit in levels, so skipping them doesn't allocate
+	var levels [16]int
+	pending := append(levels[:0], 1)
+	for len(pending) > 0 {
+		top := len(pending) - 1
+		if pending[top] == 0 {
+			pending = pending[:top]
+			continue
+		}
+		pending[top]--
+
+		head, children, nested, err := termHead(b[off:])
+		if err != nil {
+			return 0, err
+		}
+		off += head
+
+		// the open levels, but the root, are the containers holding this term
+		if nested && maxDepth > 0 && len(pending) > maxDepth {
+			return 0, &LimitError{Limit: "MaxDepth", Max: maxDepth}
+		}
+		if children > 0 {
+			pending = append(pending, children)
+		}
+	}
+
+	return off, nil
+}
+
+// termHead returns the length of the head of the term that starts at b[0], the number of
+// terms that follow it as its elements, and whether it counts as a nesting level.
+// Terms without elements have their whole length as head.
+func termHead(b []byte) (head, children int, nested bool, err error) {
+	if len(b) == 0 {
+		return 0, 0, false, errMalformed
+	}
+
+	// fixed returns the length of a term made of n bytes after its tag
+	fixed := func(n int, malformed error) (int, int, bool, error) {
+		if len(b) < 1+n {
+			return 0, 0, false, malformed
+		}
+		return 1 + n, 0, false, nil
+	}
+
+	// sized returns the length of a term whose size, stored in the sizeLen bytes after
+	// its tag and extra bytes, counts the bytes that follow it
+	sized := func(sizeLen, extra int, malformed error) (int, int, bool, error) {
+		if len(b) < 1+sizeLen {
+			return 0, 0, false, malformed
+		}
+
+		var size int
+		switch sizeLen {
+		case 1:
+			size = int(b[1])
+		case 2:
+			size = int(binary.BigEndian.Uint16(b[1:]))
+		default:
+			size = int(binary.BigEndian.Uint32(b[1:]))
+		}
+
+		return fixed(sizeLen+extra+size, malformed)
+	}
+
+	// elements returns the head of a term of headLen bytes followed by count terms
+	elements := func(headLen, count int, nested bool, malformed error) (int, int, bool, error) {
+		if len(b) < headLen {
+			return 0, 0, false, malformed
+		}
+		return headLen, count, nested, nil
+	}
+
+	// identifier returns the length of a pid, port or reference made of its node atom
+	// followed by n bytes
+	identifier := func(n int, malformed error) (int, int, bool, error) {
+		length, err := node(b, n, malformed)
+		return length, 0, false, err
+	}
+
+	switch b[0] {
+	case EttSmallInteger:
+		return fixed(SizeSmallInteger, errMalformedSmallInteger)
+	case EttInteger:
+		return fixed(SizeInteger, errMalformedInteger)
+	case EttNewFloat:
+		return fixed(SizeNewFloat, errMalformedNewFloat)
+	case EttFloat:
+		return fixed(SizeFloat, errMalformedFloat)
+	case EttNil:
+		return 1, 0, false, nil
+
+	case EttSmallAtom, EttSmallAtomUTF8:
+		return sized(SizeSmallAtomUTF8, 0, errMalformedSmallAtomUTF8)
+	case EttAtom, EttAtomUTF8:
+		return sized(SizeAtomUTF8, 0, errMalformedAtomUTF8)
+	case EttString:
+		return sized(SizeStringLength, 0, errMalformedString)
+	case EttBinary:
+		return sized(SizeBinaryLen, 0, errMalformedBinary)
+	case EttBitBinary:
+		return sized(SizeBitBinaryLen, SizeBitBinaryBits, errMalformedBitBinary)
+	case EttSmallBig:
+		return sized(SizeSmallBigN, SizeSmallBigSign, errMalformedSmallBig)
+	case EttLargeBig:
+		return sized(SizeLargeBigN, SizeLargeBigSign, errMalformedLargeBig)
+
+	case EttSmallTuple:
+		if len(b) < 1+SizeSmallTupleArity {
+			return 0, 0, false, errMalformedSmallTuple
+		}
+		return elements(1+SizeSmallTupleArity, int(b[1]), true, errMalformedSmallTuple)
+
+	case EttLargeTuple:
+		if len(b) < 1+SizeLargeTupleArity {
+			return 0, 0, false, errMalformedLargeTuple
+		}
+		return elements(1+SizeLargeTupleArity, int(binary.BigEndian.Uint32(b[1:])), true, errMalformedLargeTuple)
+
+	case EttMap:
+		if len(b) < 1+SizeMapArity {
+			return 0, 0, false, errMalformedMap
+		}
+		return elements(1+SizeMapArity, 2*int(binary.BigEndian.Uint32(b[1:])), true, errMalformedMap)
+
+	case EttList:
+		if len(b) < 1+SizeListLength {
+			return 0, 0, false, errMalformedList
+		}
+		// the elements and the tail
+		return elements(1+SizeListLength, int(binary.BigEndian.Uint32(b[1:]))+1, true, errMalformedList)
+
+	case EttPid:
+		return identifier(SizePidID+SizePidSerial+SizePidCreation, errMalformedPid)
+	case EttNewPid:
+		return identifier(SizePidID+SizePidSerial+SizeNewPidCreation, errMalformedNewPid)
+	case EttPort:
+		return identifier(SizePortID+SizePortCreation, errMalformedPort)
+	case EttNewPort:
+		return identifier(SizePortID+SizeNewPortCreation, errMalformedNewPort)
+	case EttV4Port:
+		return identifier(SizeV4PortID+SizeNewPortCreation, errMalformedV4Port)
+	case EttRef:
+		return identifier(SizeRefID+SizeRefCreation, errMalformedRef)
+
+	case EttNewReference, EttNewerReference:
+		malformed, creation := errMalformedNewRef, SizeRefCreation
+		if b[0] == EttNewerReference {
+			malformed, creation = errMalformedNewerRef, SizeNewerRefCreation
+		}
+
+		if len(b) < 1+SizeRefLen {
+			return 0, 0, false, malformed
+		}
+		ids := int(binary.BigEndian.Uint16(b[1:]))
+		if ids < 1 || ids > 5 {
+			return 0, 0, false, malformed
+		}
+
+		n, err := node(b[SizeRefLen:], creation+ids*SizeRefID, malformed)
+		return n + SizeRefLen, 0, false, err
+
+	case EttNewFun:
+		if len(b) < 1+SizeNewFunSize {
+			return 0, 0, false, errMalformedNewFun
+		}
+		// the size counts itself
+		size := int(binary.BigEndian.Uint32(b[1:]))
+		if size < SizeNewFunSize {
+			return 0, 0, false, errMalformedNewFun
+		}
+		head, _, _, err := fixed(size, errMalformedNewFun)
+		return head, 0, true, err
+
+	case EttFun:
+		if len(b) < 1+SizeFunNumFree {
+			return 0, 0, false, errMalformedFun
+		}
+		// the pid, the module, the index, the uniq and the free variables
+		return elements(1+SizeFunNumFree, 4+int(binary.BigEndian.Uint32(b[1:])), true, errMalformedFun)
+
+	case EttExport:
+		return elements(1, 3, false, errMalformedExport)
+	}
+
+	return 0, 0, false, fmt.Errorf("value error: unknown tag %d", b[0])
+}
+
+// node returns the length of a pid, port or reference term made of its node atom
+// followed by n bytes.
+func node(b []byte, n int, malformed error) (int, error) {
+	atom, err := skipTerm(b[1:])
+	if err != nil {
+		return 0, malformed
+	}
+
+	if len(b) < 1+atom+n {
+		return 0, malformed
+	}
+
+	return 1 + atom + n, nil
+}
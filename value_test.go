@@ -0,0 +1,136 @@
+package goetf_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"math/big"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/nicolito128/goetf"
+)
+
+func TestValue(t *testing.T) {
+	data, err := goetf.Marshal(map[goetf.Atom]any{
+		"type": goetf.Binary("route"),
+		"id":   42,
+		"meta": goetf.Tuple{goetf.Atom("ok"), goetf.List{1, 2, 3}, goetf.Charlist("hi")},
+		"big":  big.NewInt(-1 << 40),
+	})
+	if err != nil {
+		t.Fatal("marshal error:", err)
+	}
+
+	v, err := goetf.ParseValue(data)
+	if err != nil {
+		t.Fatal("parse error:", err)
+	}
+
+	if v.Kind() != goetf.KindMap || v.Len() != 4 {
+		t.Fatalf("value error: want = %v got = %v", goetf.KindMap, v.Kind())
+	}
+	{
+		id, ok := v.MapGet("id")
+		if !ok {
+			t.Fatal("value error: id not found")
+		}
+
+		if n, err := id.Int(); err != nil || n != 42 {
+			t.Errorf("value error: want = %v got = %v (%v)", 42, n, err)
+		}
+
+		large, _ := v.MapGet("big")
+		if n, err := large.Int(); err != nil || n != -1<<40 {
+			t.Errorf("value error: want = %v got = %v (%v)", -1<<40, n, err)
+		}
+
+		typ, _ := v.MapGet("type")
+		if b, err := typ.Bytes(); err != nil || string(b) != "route" {
+			t.Errorf("value error: want = %v got = %s (%v)", "route", b, err)
+		}
+
+		if _, ok := v.MapGet("missing"); ok {
+			t.Errorf("value error: missing key found")
+		}
+	}
+	{
+		meta, _ := v.MapGet("meta")
+		tag, err := meta.TupleElem(0)
+		if err != nil {
+			t.Fatal("value error:", err)
+		}
+
+		if name, err := tag.AtomString(); err != nil || name != "ok" {
+			t.Errorf("value error: want = %v got = %v (%v)", "ok", name, err)
+		}
+
+		if _, err := tag.Int(); err == nil {
+			t.Errorf("value error: expected error for an atom")
+		}
+
+		for i, want := range []int64{6, 104 + 105} {
+			list, err := meta.TupleElem(i + 1)
+			if err != nil {
+				t.Fatal("value error:", err)
+			}
+
+			var sum int64
+			it := list.ListIter()
+			for it.Next() {
+				n, err := it.Value().Int()
+				if err != nil {
+					t.Fatal("value error:", err)
+				}
+				sum += n
+			}
+
+			if it.Err() != nil || sum != want {
+				t.Errorf("value error: want = %v got = %v (%v)", want, sum, it.Err())
+			}
+		}
+
+		if _, err := meta.TupleElem(3); err == nil {
+			t.Errorf("value error: expected error for an index out of range")
+		}
+	}
+	{
+		allocs := testing.AllocsPerRun(100, func() {
+			id, _ := v.MapGet("id")
+			id.Int()
+		})
+
+		if allocs != 0 {
+			t.Errorf("value error: want = %v allocations got = %v", 0, allocs)
+		}
+	}
+	{
+		if _, err := goetf.ParseValue(data[:len(data)-1]); err == nil {
+			t.Errorf("parse error: expected error for a truncated term")
+		}
+	}
+	{
+		// incompressible data that claims to inflate to 2 MB, within the deflate ratio
+		raw := make([]byte, 2000)
+		rand.New(rand.NewSource(1)).Read(raw)
+
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(raw)
+		zw.Close()
+
+		bad := append([]byte{131, 80, 0, 30, 132, 128}, z.Bytes()...)
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		if _, err := goetf.ParseValue(bad); err == nil {
+			t.Errorf("parse error: expected error for a wrong uncompressed size")
+		}
+
+		runtime.ReadMemStats(&after)
+		if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+			t.Errorf("parse error: allocated %d bytes for %d compressed bytes", alloc, z.Len())
+		}
+	}
+}